@@ -7,4 +7,6 @@ require (
 	golang.org/x/text v0.27.0
 )
 
-require github.com/mattn/go-sqlite3 v1.14.29 // indirect
+require github.com/mattn/go-sqlite3 v1.14.29
+
+require gopkg.in/yaml.v3 v3.0.1
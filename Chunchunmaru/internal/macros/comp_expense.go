@@ -6,12 +6,12 @@ import (
 	"fmt"
 	"html/template"
 	"math"
-	"math/rand"
+	"slices"
 	"strings"
 )
 
 // FilterGenerator defines a function signature for generators of SVG filter primitives.
-type FilterGenerator func() string
+type FilterGenerator func(g *generator) string
 
 const (
 	svgWidth  = 500
@@ -35,25 +35,25 @@ var binaryOps = []string{
 var vars = []string{"i", "j", "waste", "i+j", "i-j", "i*j", "i/j", "j+1", "i%10", "j%10"}
 
 // randomJSExpr Recursively build a random JS math expression
-func randomJSExpr(depth int) string {
-	if depth <= 0 || rand.Float64() < 0.3 {
-		v := vars[rand.Intn(len(vars))]
+func (g *generator) randomJSExpr(depth int) string {
+	if depth <= 0 || g.rng.Float64() < 0.3 {
+		v := vars[g.rng.Intn(len(vars))]
 		if strings.TrimSpace(v) == "" {
 			return "1"
 		}
 		return v
 	}
-	if rand.Float64() < 0.5 {
-		op := unaryOps[rand.Intn(len(unaryOps))]
-		inner := randomJSExpr(depth - 1)
+	if g.rng.Float64() < 0.5 {
+		op := unaryOps[g.rng.Intn(len(unaryOps))]
+		inner := g.randomJSExpr(depth - 1)
 		if strings.TrimSpace(inner) == "" {
 			inner = "1"
 		}
 		return strings.Replace(op, "%s", inner, 1)
 	} else {
-		op := binaryOps[rand.Intn(len(binaryOps))]
-		left := randomJSExpr(depth - 1)
-		right := randomJSExpr(depth - 1)
+		op := binaryOps[g.rng.Intn(len(binaryOps))]
+		left := g.randomJSExpr(depth - 1)
+		right := g.randomJSExpr(depth - 1)
 		if strings.TrimSpace(left) == "" {
 			left = "1"
 		}
@@ -71,13 +71,13 @@ func randomJSExpr(depth int) string {
 }
 
 // nestDivs
-func nestDivs(count int) template.HTML {
+func (g *generator) nestDivs(count int) template.HTML {
 	if count <= 0 {
 		return ""
 	}
 	var classPool []string
 	for i := 0; i < 100; i++ {
-		classPool = append(classPool, randomWord()+fmt.Sprint(rand.Intn(10000)))
+		classPool = append(classPool, g.randomWord()+fmt.Sprint(g.rng.Intn(10000)))
 	}
 	var build func(depth int) string
 	build = func(depth int) string {
@@ -85,34 +85,34 @@ func nestDivs(count int) template.HTML {
 			return "content"
 		}
 		// Random class list
-		classCount := rand.Intn(8) + 3
+		classCount := g.rng.Intn(8) + 3
 		classes := make([]string, classCount)
 		for i := range classes {
-			classes[i] = classPool[rand.Intn(len(classPool))]
+			classes[i] = classPool[g.rng.Intn(len(classPool))]
 		}
 		// Random inline styles
-		styleCount := rand.Intn(6) + 3
+		styleCount := g.rng.Intn(6) + 3
 		var style strings.Builder
 		for i := 0; i < styleCount; i++ {
-			style.WriteString(utilities.GenerateRandomInlineCSS())
+			style.WriteString(utilities.GenerateRandomInlineCSS(g.rng))
 		}
 		// Random attributes
-		attrCount := rand.Intn(4) + 1
+		attrCount := g.rng.Intn(4) + 1
 		var attrs strings.Builder
 		for i := 0; i < attrCount; i++ {
-			switch rand.Intn(3) {
+			switch g.rng.Intn(3) {
 			case 0:
-				attrs.WriteString(fmt.Sprintf(" data-%s=\"%s\"", randomWord(), randomWord()))
+				attrs.WriteString(fmt.Sprintf(" data-%s=\"%s\"", g.randomWord(), g.randomWord()))
 			case 1:
-				attrs.WriteString(fmt.Sprintf(" aria-%s=\"%s\"", randomWord(), randomWord()))
+				attrs.WriteString(fmt.Sprintf(" aria-%s=\"%s\"", g.randomWord(), g.randomWord()))
 			case 2:
-				attrs.WriteString(fmt.Sprintf(" id=\"%s\"", utilities.RandomStringFromCharset(8, utilities.LowerAlphabetChars)))
+				attrs.WriteString(fmt.Sprintf(" id=\"%s\"", utilities.RandomStringFromCharset(g.rng, 8, utilities.LowerAlphabetChars)))
 			}
 		}
 		// Randomly insert other elements
 		var inner string
-		if rand.Float64() < 0.3 && depth > 1 {
-			inner = fmt.Sprintf("<span>%s</span>%s<b>%s</b>", randomWord(), build(depth-1), randomWord())
+		if g.rng.Float64() < 0.3 && depth > 1 {
+			inner = fmt.Sprintf("<span>%s</span>%s<b>%s</b>", g.randomWord(), build(depth-1), g.randomWord())
 		} else {
 			inner = build(depth - 1)
 		}
@@ -122,14 +122,14 @@ func nestDivs(count int) template.HTML {
 }
 
 // randomComplexTable
-func randomComplexTable(rows, cols int) template.HTML {
+func (g *generator) randomComplexTable(rows, cols int) template.HTML {
 	if rows < 1 || cols < 1 {
 		return ""
 	}
 	var builder strings.Builder
 	builder.WriteString("<table")
-	if rand.Float64() < 0.5 {
-		builder.WriteString(fmt.Sprintf(" class=\"%s\"", randomWord()))
+	if g.rng.Float64() < 0.5 {
+		builder.WriteString(fmt.Sprintf(" class=\"%s\"", g.randomWord()))
 	}
 	builder.WriteString(">\n")
 	sections := []string{"thead", "tbody", "tfoot"}
@@ -144,29 +144,29 @@ func randomComplexTable(rows, cols int) template.HTML {
 			builder.WriteString("<tr>\n")
 			c := 0
 			for c < cols {
-				if rand.Float64() < 0.2 && c < cols-1 {
+				if g.rng.Float64() < 0.2 && c < cols-1 {
 					// Nested table
 					builder.WriteString("<td>")
-					builder.WriteString(string(randomComplexTable(1, rand.Intn(2)+1)))
+					builder.WriteString(string(g.randomComplexTable(1, g.rng.Intn(2)+1)))
 					builder.WriteString("</td>")
 					c++
 					continue
 				}
-				colspan := rand.Intn(5) + 1
-				rowspan := rand.Intn(5) + 1
+				colspan := g.rng.Intn(5) + 1
+				rowspan := g.rng.Intn(5) + 1
 				if c+colspan > cols {
 					colspan = cols - c
 				}
 				tag := "td"
-				if rand.Float64() < 0.2 {
+				if g.rng.Float64() < 0.2 {
 					tag = "th"
 				}
-				style := utilities.GenerateRandomInlineCSS()
+				style := utilities.GenerateRandomInlineCSS(g.rng)
 				attr := ""
-				if rand.Float64() < 0.5 {
-					attr = fmt.Sprintf(" data-%s=\"%s\"", randomWord(), randomWord())
+				if g.rng.Float64() < 0.5 {
+					attr = fmt.Sprintf(" data-%s=\"%s\"", g.randomWord(), g.randomWord())
 				}
-				content := randomWord() + fmt.Sprintf(" (%d,%d)", rowIdx, c)
+				content := g.randomWord() + fmt.Sprintf(" (%d,%d)", rowIdx, c)
 				builder.WriteString(fmt.Sprintf("<%s colspan=\"%d\" rowspan=\"%d\" style=\"%s\"%s>%s</%s>\n", tag, colspan, rowspan, style, attr, content, tag))
 				c += colspan
 			}
@@ -185,56 +185,56 @@ type StyleBlock struct {
 }
 
 // randomStyleBlock
-func randomStyleBlock(styleType string, count int) StyleBlock {
-	parentClass := "p" + utilities.RandomStringFromCharset(12, utilities.LowerAlphabetChars)
+func (g *generator) randomStyleBlock(styleType string, count int) StyleBlock {
+	parentClass := "p" + utilities.RandomStringFromCharset(g.rng, 12, utilities.LowerAlphabetChars)
 	var builder strings.Builder
 	builder.WriteString("<style>\n")
 	switch styleType {
 	case "utility":
 		for i := 0; i < count; i++ {
-			class := "u" + utilities.RandomStringFromCharset(10, utilities.LowerAlphabetChars)
+			class := "u" + utilities.RandomStringFromCharset(g.rng, 10, utilities.LowerAlphabetChars)
 			props := ""
-			for j := 0; j < rand.Intn(8)+3; j++ {
-				props += utilities.GenerateRandomInlineCSS()
+			for j := 0; j < g.rng.Intn(8)+3; j++ {
+				props += utilities.GenerateRandomInlineCSS(g.rng)
 			}
 			builder.WriteString(fmt.Sprintf(".%s .%s { %s }\n", parentClass, class, props))
 		}
 	case "nested":
 		for i := 0; i < count; i++ {
 			selector := "." + parentClass
-			depth := rand.Intn(8) + 3
+			depth := g.rng.Intn(8) + 3
 			for d := 0; d < depth; d++ {
 				selector += " > div"
-				if rand.Float64() < 0.5 {
-					selector += fmt.Sprintf(":nth-child(%d)", rand.Intn(10)+1)
+				if g.rng.Float64() < 0.5 {
+					selector += fmt.Sprintf(":nth-child(%d)", g.rng.Intn(10)+1)
 				}
-				if rand.Float64() < 0.3 {
+				if g.rng.Float64() < 0.3 {
 					selector += fmt.Sprintf(" + span")
 				}
 			}
 			props := ""
-			for j := 0; j < rand.Intn(8)+3; j++ {
-				props += utilities.GenerateRandomInlineCSS()
+			for j := 0; j < g.rng.Intn(8)+3; j++ {
+				props += utilities.GenerateRandomInlineCSS(g.rng)
 			}
 			builder.WriteString(fmt.Sprintf("%s { %s }\n", selector, props))
 		}
 	case "complex":
 		for i := 0; i < count; i++ {
-			attr := fmt.Sprintf("[data-%s=\"%s\"]", randomWord(), randomWord())
-			pseudo := ":" + utilities.RandomKeyword([]string{
+			attr := fmt.Sprintf("[data-%s=\"%s\"]", g.randomWord(), g.randomWord())
+			pseudo := ":" + utilities.RandomKeyword(g.rng, []string{
 				"hover", "active", "focus", "nth-child(2)", "not(:last-child)", "first-of-type", "last-of-type", "nth-of-type(odd)", "nth-of-type(even)",
 			})
 			pseudoElem := ""
-			if rand.Float64() < 0.5 {
-				pseudoElem = "::" + utilities.RandomKeyword([]string{"before", "after", "marker", "selection"})
+			if g.rng.Float64() < 0.5 {
+				pseudoElem = "::" + utilities.RandomKeyword(g.rng, []string{"before", "after", "marker", "selection"})
 			}
 			combinator := ""
-			if rand.Float64() < 0.5 {
-				combinator = " > " + utilities.RandomKeyword([]string{"span", "b", "i", "u"})
+			if g.rng.Float64() < 0.5 {
+				combinator = " > " + utilities.RandomKeyword(g.rng, []string{"span", "b", "i", "u"})
 			}
 			props := ""
-			for j := 0; j < rand.Intn(8)+3; j++ {
-				props += utilities.GenerateRandomInlineCSS()
+			for j := 0; j < g.rng.Intn(8)+3; j++ {
+				props += utilities.GenerateRandomInlineCSS(g.rng)
 			}
 			builder.WriteString(fmt.Sprintf(".%s %s%s%s%s { %s }\n", parentClass, attr, pseudo, pseudoElem, combinator, props))
 		}
@@ -249,14 +249,14 @@ func randomStyleBlock(styleType string, count int) StyleBlock {
 // generateFractalSVG creates an SVG of a fractal tree. The parameters of the tree
 // (depth, angles, length, branches) are randomized to make each SVG unique and
 // computationally expensive in a different way for the client's renderer.
-func generateFractalSVG() string {
+func (g *generator) generateFractalSVG() string {
 	var pathBuilder strings.Builder
-	initialLength := float64(rand.Intn(110-70) + 70)
-	initialAngle := -90.0                // Start pointing up
-	recursionDepth := rand.Intn(5-4) + 4 // Depth between 4 and 5
+	initialLength := float64(g.rng.Intn(110-70) + 70)
+	initialAngle := -90.0                 // Start pointing up
+	recursionDepth := g.rng.Intn(5-4) + 4 // Depth between 4 and 5
 
 	// Begin the recursive drawing process from the bottom-center of the SVG canvas.
-	drawFractalBranch(&pathBuilder, svgWidth/2, svgHeight, initialAngle, initialLength, recursionDepth)
+	g.drawFractalBranch(&pathBuilder, svgWidth/2, svgHeight, initialAngle, initialLength, recursionDepth)
 
 	// Assemble the final SVG string.
 	svg := fmt.Sprintf(
@@ -265,13 +265,13 @@ func generateFractalSVG() string {
 			`</svg>`,
 		svgWidth, svgHeight, svgWidth, svgHeight,
 		pathBuilder.String(),
-		randomColor(), // Assumes randomColor() is an available macro function
+		g.randomColor(), // Assumes randomColor() is an available macro function
 	)
 	return svg
 }
 
 // drawFractalBranch is a recursive helper function that builds the fractal path data.
-func drawFractalBranch(path *strings.Builder, x1, y1, angle, length float64, depth int) {
+func (g *generator) drawFractalBranch(path *strings.Builder, x1, y1, angle, length float64, depth int) {
 	if depth <= 0 {
 		return
 	}
@@ -285,47 +285,48 @@ func drawFractalBranch(path *strings.Builder, x1, y1, angle, length float64, dep
 	path.WriteString(fmt.Sprintf("M%.2f,%.2f L%.2f,%.2f ", x1, y1, x2, y2))
 
 	// For the next recursion level, randomize the number of new branches and their properties.
-	numBranches := rand.Intn(3-2) + 2 // 2 or 3 branches
+	numBranches := g.rng.Intn(3-2) + 2 // 2 or 3 branches
 	for i := 0; i < numBranches; i++ {
 		// Each new branch has a randomly perturbed angle and reduced length.
-		newAngle := angle + (-40 + rand.Float64()*(40-(-40)))     // Angle change between -40 and +40
-		newLength := length * (0.70 + rand.Float64()*(0.85-0.70)) // Length scales between 70% and 85%
-		drawFractalBranch(path, x2, y2, newAngle, newLength, depth-1)
+		newAngle := angle + (-40 + g.rng.Float64()*(40-(-40)))     // Angle change between -40 and +40
+		newLength := length * (0.70 + g.rng.Float64()*(0.85-0.70)) // Length scales between 70% and 85%
+		g.drawFractalBranch(path, x2, y2, newAngle, newLength, depth-1)
 	}
 }
 
-// A list of available filter generator functions. This list is shuffled on each call
+// A list of available filter generator functions. A copy of this list is shuffled on each call
 // to randomize the filter chain's composition and order.
 var filterGenerators = []FilterGenerator{
-	generateFeGaussianBlur,
-	generateFeMorphology,
-	generateFeTurbulence,
-	generateFeColorMatrix,
-	generateFeConvolveMatrix,
-	generateFeDisplacementMap,
+	(*generator).generateFeGaussianBlur,
+	(*generator).generateFeMorphology,
+	(*generator).generateFeTurbulence,
+	(*generator).generateFeColorMatrix,
+	(*generator).generateFeConvolveMatrix,
+	(*generator).generateFeDisplacementMap,
 }
 
 // generateFiltersSVG creates an SVG with a randomized chain of complex filters applied
 // to a simple shape. This forces a heavy computational load on the client's rendering engine.
-func generateFiltersSVG() string {
+func (g *generator) generateFiltersSVG() string {
 	// Updated to match spec: randomId "prefix" count
-	filterID := randomId("filter", 8) // Assumes randomId() is available
-	numFilters := rand.Intn(5-3) + 3  // Chain of 3 to 5 filters
+	filterID := g.randomId("filter", 8) // Assumes randomId() is available
+	numFilters := g.rng.Intn(5-3) + 3   // Chain of 3 to 5 filters
 	var filterChain strings.Builder
 
-	// Create a randomized pipeline of filters.
-	rand.Shuffle(len(filterGenerators), func(i, j int) {
-		filterGenerators[i], filterGenerators[j] = filterGenerators[j], filterGenerators[i]
+	// Create a randomized pipeline of filters. Shuffle a copy so concurrent renders don't race on the shared list.
+	generators := slices.Clone(filterGenerators)
+	g.rng.Shuffle(len(generators), func(i, j int) {
+		generators[i], generators[j] = generators[j], generators[i]
 	})
 
 	// Build the filter chain from the shuffled list.
-	for i := 0; i < numFilters && i < len(filterGenerators); i++ {
-		filterChain.WriteString(filterGenerators[i]())
+	for i := 0; i < numFilters && i < len(generators); i++ {
+		filterChain.WriteString(generators[i](g))
 	}
 
 	// Define a simple shape to apply the complex filter to.
-	rectWidth := rand.Intn(300-200) + 200
-	rectHeight := rand.Intn(250-150) + 150
+	rectWidth := g.rng.Intn(300-200) + 200
+	rectHeight := g.rng.Intn(250-150) + 150
 	rectX := (svgWidth - rectWidth) / 2
 	rectY := (svgHeight - rectHeight) / 2
 
@@ -343,125 +344,125 @@ func generateFiltersSVG() string {
 		filterID,
 		filterChain.String(),
 		rectX, rectY, rectWidth, rectHeight,
-		randomColor(), // Assumes randomColor() is available
+		g.randomColor(), // Assumes randomColor() is available
 		filterID,
 	)
 	return svg
 }
 
 // generateFeGaussianBlur
-func generateFeGaussianBlur() string {
-	deviation := rand.Intn(6-2) + 2
+func (g *generator) generateFeGaussianBlur() string {
+	deviation := g.rng.Intn(6-2) + 2
 	return fmt.Sprintf(`<feGaussianBlur stdDeviation="%d" />`, deviation)
 }
 
 // generateFeMorphology
-func generateFeMorphology() string {
+func (g *generator) generateFeMorphology() string {
 	operators := []string{"erode", "dilate"}
-	operator := operators[rand.Intn(len(operators))]
-	radius := rand.Intn(5-2) + 2
+	operator := operators[g.rng.Intn(len(operators))]
+	radius := g.rng.Intn(5-2) + 2
 	return fmt.Sprintf(`<feMorphology operator="%s" radius="%d" />`, operator, radius)
 }
 
 // generateFeTurbulence
-func generateFeTurbulence() string {
-	baseFreq := 0.01 + rand.Float64()*(0.08-0.01)
-	numOctaves := rand.Intn(4-2) + 2
+func (g *generator) generateFeTurbulence() string {
+	baseFreq := 0.01 + g.rng.Float64()*(0.08-0.01)
+	numOctaves := g.rng.Intn(4-2) + 2
 	turbulenceTypes := []string{"fractalNoise", "turbulence"}
-	turbulenceType := turbulenceTypes[rand.Intn(len(turbulenceTypes))]
+	turbulenceType := turbulenceTypes[g.rng.Intn(len(turbulenceTypes))]
 	return fmt.Sprintf(`<feTurbulence type="%s" baseFrequency="%.4f" numOctaves="%d" result="noise" />`, turbulenceType, baseFreq, numOctaves)
 }
 
 // generateFeDisplacementMap
-func generateFeDisplacementMap() string {
-	scale := rand.Intn(75-20) + 20
+func (g *generator) generateFeDisplacementMap() string {
+	scale := g.rng.Intn(75-20) + 20
 	return fmt.Sprintf(`<feDisplacementMap in="SourceGraphic" in2="noise" scale="%d" />`, scale)
 }
 
 // generateFeColorMatrix
-func generateFeColorMatrix() string {
+func (g *generator) generateFeColorMatrix() string {
 	types := []string{"saturate", "hueRotate"}
-	matrixType := types[rand.Intn(len(types))]
+	matrixType := types[g.rng.Intn(len(types))]
 	var value float64
 	if matrixType == "hueRotate" {
-		value = float64(rand.Intn(360))
+		value = float64(g.rng.Intn(360))
 	} else { // saturate
-		value = rand.Float64() // a value between 0.0 and 1.0
+		value = g.rng.Float64() // a value between 0.0 and 1.0
 	}
 	return fmt.Sprintf(`<feColorMatrix type="%s" values="%.2f" />`, matrixType, value)
 }
 
 // generateFeConvolveMatrix
-func generateFeConvolveMatrix() string {
+func (g *generator) generateFeConvolveMatrix() string {
 	var kernelMatrix strings.Builder
 	for i := 0; i < 9; i++ {
 		// Value between -1.5 and 1.5
-		v := -1.5 + rand.Float64()*(1.5-(-1.5))
+		v := -1.5 + g.rng.Float64()*(1.5-(-1.5))
 		kernelMatrix.WriteString(fmt.Sprintf("%.2f ", v))
 	}
 	order := 3 // 3x3 matrix
-	bias := rand.Float64() * 0.3
+	bias := g.rng.Float64() * 0.3
 	return fmt.Sprintf(`<feConvolveMatrix order="%d" kernelMatrix="%s" bias="%.2f" />`, order, strings.TrimSpace(kernelMatrix.String()), bias)
 }
 
 // randomSVG is the function registered in the template FuncMap. It acts as a
 // dispatcher, calling the appropriate generator based on the provided type.
 // It returns template.HTML to prevent auto-escaping of the SVG markup.
-func randomSVG(svgType string) template.HTML {
+func (g *generator) randomSVG(svgType string) template.HTML {
 	switch svgType {
 	case "fractal":
-		return template.HTML(generateFractalSVG())
+		return template.HTML(g.generateFractalSVG())
 	case "filters":
-		return template.HTML(generateFiltersSVG())
+		return template.HTML(g.generateFiltersSVG())
 	default:
 		// Return an error for an unknown type, allowing for robust error handling.
 		return ""
 	}
 }
 
-func randomCSSVars(count int) template.HTML {
+func (g *generator) randomCSSVars(count int) template.HTML {
 	if count < 3 {
 		count = 3
 	}
 	var builder strings.Builder
 	builder.WriteString("<style>\n:root {\n")
-	builder.WriteString(fmt.Sprintf("  --v1: %dpx;\n", rand.Intn(100)+1))
-	builder.WriteString(fmt.Sprintf("  --v2: %dpx;\n", rand.Intn(100)+1))
+	builder.WriteString(fmt.Sprintf("  --v1: %dpx;\n", g.rng.Intn(100)+1))
+	builder.WriteString(fmt.Sprintf("  --v2: %dpx;\n", g.rng.Intn(100)+1))
 	for i := 3; i <= count; i++ {
 		refs := []string{}
-		refCount := rand.Intn(3) + 1
+		refCount := g.rng.Intn(3) + 1
 		for j := 0; j < refCount; j++ {
-			refs = append(refs, fmt.Sprintf("var(--v%d)", rand.Intn(i-1)+1))
+			refs = append(refs, fmt.Sprintf("var(--v%d)", g.rng.Intn(i-1)+1))
 		}
-		op := utilities.RandomKeyword([]string{"+", "-", "*", "/", "min", "max"})
+		op := utilities.RandomKeyword(g.rng, []string{"+", "-", "*", "/", "min", "max"})
 		expr := ""
 		if op == "min" || op == "max" {
-			expr = fmt.Sprintf("%s(%s, %dpx)", op, strings.Join(refs, ", "), rand.Intn(100)+1)
+			expr = fmt.Sprintf("%s(%s, %dpx)", op, strings.Join(refs, ", "), g.rng.Intn(100)+1)
 		} else {
 			expr = refs[0]
 			for _, r := range refs[1:] {
 				expr += fmt.Sprintf(" %s %s", op, r)
 			}
-			expr += fmt.Sprintf(" %s %dpx", op, rand.Intn(100)+1)
+			expr += fmt.Sprintf(" %s %dpx", op, g.rng.Intn(100)+1)
 		}
 		builder.WriteString(fmt.Sprintf("  --v%d: calc(%s);\n", i, expr))
 	}
 	// Randomly insert a cycle (for chaos)
-	if count > 5 && rand.Float64() < 0.3 {
+	if count > 5 && g.rng.Float64() < 0.3 {
 		builder.WriteString(fmt.Sprintf("  --v1: calc(var(--v%d) + 1px);\n", count))
 	}
 	builder.WriteString("}\n</style>")
 	return template.HTML(builder.String())
 }
 
-func jsInteractiveContent(typ, content string) template.HTML {
-	placeholderID := "ph" + utilities.RandomStringFromCharset(12, utilities.LowerAlphabetChars)
+func (g *generator) jsInteractiveContent(typ, content string) template.HTML {
+	placeholderID := "ph" + utilities.RandomStringFromCharset(g.rng, 12, utilities.LowerAlphabetChars)
 
 	// Generate a random number of random expressions for the waste loop
-	numExpr := rand.Intn(4) + 3 // 3–6 expressions
+	numExpr := g.rng.Intn(4) + 3 // 3–6 expressions
 	var exprs []string
 	for i := 0; i < numExpr; i++ {
-		exprs = append(exprs, "waste+="+randomJSExpr(3)+";")
+		exprs = append(exprs, "waste+="+g.randomJSExpr(3)+";")
 	}
 	concatMath := strings.Join(exprs, "\n    ")
 
@@ -476,7 +477,7 @@ for(let i=0;i<1e5;i++){
 `, concatMath)
 
 	// Obfuscation strategies
-	key := byte(rand.Intn(256))
+	key := byte(g.rng.Intn(256))
 	type obfStrategy struct {
 		name   string
 		encode func(string) (string, string)
@@ -529,7 +530,7 @@ for(let i=0;i<b.length;i++){data+=String.fromCharCode(b.charCodeAt(i)^%d);}
 	}
 
 	// Randomly pick a strategy
-	strategy := strategies[rand.Intn(len(strategies))]
+	strategy := strategies[g.rng.Intn(len(strategies))]
 	encoded, decodeJS := strategy.encode(content)
 
 	// Compose the script
@@ -8,7 +8,7 @@ func BenchmarkNestDivs(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = nestDivs(10)
+		result = testGen.nestDivs(10)
 	}
 
 	printTestResults(b.Name(), result)
@@ -17,7 +17,7 @@ func BenchmarkRandomComplexTable(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomComplexTable(10, 5)
+		result = testGen.randomComplexTable(10, 5)
 	}
 
 	printTestResults(b.Name(), result)
@@ -26,7 +26,7 @@ func BenchmarkRandomStyleBlock(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomStyleBlock("utility", 8)
+		result = testGen.randomStyleBlock("utility", 8)
 	}
 
 	printTestResults(b.Name(), result)
@@ -35,7 +35,7 @@ func BenchmarkRandomStyleBlock2(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomStyleBlock("nested", 6)
+		result = testGen.randomStyleBlock("nested", 6)
 	}
 
 	printTestResults(b.Name(), result)
@@ -44,7 +44,7 @@ func BenchmarkRandomStyleBlock3(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomStyleBlock("complex", 7)
+		result = testGen.randomStyleBlock("complex", 7)
 	}
 
 	printTestResults(b.Name(), result)
@@ -53,7 +53,7 @@ func BenchmarkRandomSVG(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomSVG("fractal")
+		result = testGen.randomSVG("fractal")
 	}
 
 	printTestResults(b.Name(), result)
@@ -62,7 +62,7 @@ func BenchmarkRandomSVG2(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomSVG("filters")
+		result = testGen.randomSVG("filters")
 	}
 
 	printTestResults(b.Name(), result)
@@ -71,7 +71,7 @@ func BenchmarkRandomCSSVars(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomCSSVars(11)
+		result = testGen.randomCSSVars(11)
 	}
 
 	printTestResults(b.Name(), result)
@@ -80,7 +80,7 @@ func BenchmarkJsInteractiveContent(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = jsInteractiveContent("div", "Hello World!")
+		result = testGen.jsInteractiveContent("div", "Hello World!")
 	}
 
 	printTestResults(b.Name(), result)
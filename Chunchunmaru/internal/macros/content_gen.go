@@ -2,46 +2,48 @@ package macros
 
 import (
 	"chunchunmaru/internal/utilities"
-	"github.com/mb-14/gomarkov"
-	"math/rand"
 	"strings"
 	"time"
 	"unicode"
 )
 
-func markovSentence(length int) string {
-	if utilities.MarkovModel == nil {
+func (g *generator) markovSentence(length int) string {
+	return g.markovSentenceFrom(utilities.DefaultModel, length)
+}
+
+// markovSentenceFrom Generates a sentence of up to length tokens from the named model, or nothing if there is no such
+// model
+func (g *generator) markovSentenceFrom(model string, length int) string {
+	chain := utilities.MarkovModels.Get(model)
+	if chain == nil {
 		return ""
 	}
-	order := utilities.MarkovModel.Order
-	tokens := make([]string, 0)
-	for i := 0; i < order; i++ {
-		tokens = append(tokens, gomarkov.StartToken)
-	}
-	for tokens[len(tokens)-1] != gomarkov.EndToken && len(tokens) < length {
-		next, _ := utilities.MarkovModel.Generate(tokens[(len(tokens) - order):])
-		tokens = append(tokens, next)
-	}
-	return strings.Join(tokens[order:len(tokens)-1], " ") + "."
+	return strings.Join(utilities.GenerateSentence(chain, g.rng, length), " ") + "."
 }
 
-func markovParagraphs(count, minSentences, maxSentences, minSentenceLength, maxSentenceLength int) string {
+func (g *generator) markovParagraphs(count, minSentences, maxSentences, minSentenceLength, maxSentenceLength int) string {
+	return g.markovParagraphsFrom(utilities.DefaultModel, count, minSentences, maxSentences, minSentenceLength, maxSentenceLength)
+}
+
+// markovParagraphsFrom Generates count paragraphs from the named model
+func (g *generator) markovParagraphsFrom(model string, count, minSentences, maxSentences, minSentenceLength, maxSentenceLength int) string {
 	output := ""
 
 	for i := 0; i < count; i++ {
-		for j := 0; j < randomInt(minSentences, maxSentences); j++ {
-			output = output + markovSentence(randomInt(minSentenceLength, maxSentenceLength)) + " "
+		sentences := g.randomInt(minSentences, maxSentences)
+		for j := 0; j < sentences; j++ {
+			output = output + g.markovSentenceFrom(model, g.randomInt(minSentenceLength, maxSentenceLength)) + " "
 		}
 		output = output + "\n"
 	}
 	return output
 }
 
-func randomWord() string {
-	return utilities.CleanString(utilities.RandomWord())
+func (g *generator) randomWord() string {
+	return utilities.CleanString(utilities.RandomWord(g.rng))
 }
 
-func randomSentence(len int) string {
+func (g *generator) randomSentence(len int) string {
 	if len <= 0 {
 		return ""
 	}
@@ -51,7 +53,7 @@ func randomSentence(len int) string {
 	builder.Grow(len * utilities.AvgWordLen)
 
 	for i := 0; i < len; i++ {
-		word := utilities.RandomWord()
+		word := utilities.RandomWord(g.rng)
 		if i == 0 {
 			runes := []rune(word)
 			runes[0] = unicode.ToUpper(runes[0])
@@ -67,15 +69,15 @@ func randomSentence(len int) string {
 	return builder.String()
 }
 
-func randomParagraphs(count, minSentences, maxSentences, minSentenceLength, maxSentenceLength int) string {
+func (g *generator) randomParagraphs(count, minSentences, maxSentences, minSentenceLength, maxSentenceLength int) string {
 	var builder strings.Builder
 
 	builder.Grow(count * utilities.AvgWordLen * (minSentenceLength + maxSentenceLength) * (minSentences + maxSentences) / 4)
 
 	for i := 0; i < count; i++ {
-		sentences := rand.Intn(maxSentences-minSentences) + minSentences
+		sentences := g.randomInt(minSentences, maxSentences)
 		for j := 0; j < sentences; j++ {
-			builder.WriteString(randomSentence(rand.Intn(maxSentenceLength-minSentenceLength) + minSentenceLength))
+			builder.WriteString(g.randomSentence(g.randomInt(minSentenceLength, maxSentenceLength)))
 			if j < sentences-1 {
 				builder.WriteByte(' ')
 			}
@@ -89,24 +91,32 @@ func randomParagraphs(count, minSentences, maxSentences, minSentenceLength, maxS
 	return builder.String()
 }
 
-func randomString(t string, len int) string {
+func (g *generator) randomString(t string, len int) string {
 	switch t {
 	case "username":
-		return utilities.RandomWord() + utilities.RandomWord()
+		return utilities.RandomUsername(g.rng, len)
 	case "email":
-		return utilities.RandomWord() + utilities.RandomWord() + "@gmail.com"
+		return utilities.RandomEmail(g.rng, g.config.EmailDomains)
+	case "surname":
+		return utilities.RandomSurname(g.rng, len)
+	case "company":
+		return utilities.RandomCompany(g.rng)
+	case "domain":
+		return utilities.RandomDomain(g.rng)
+	case "product":
+		return utilities.RandomProductCode(g.rng)
 	case "uuid":
-		return utilities.RandomStringFromCharset(8, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(4, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(4, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(4, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(12, utilities.LowerHexChars)
+		return utilities.RandomStringFromCharset(g.rng, 8, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(g.rng, 4, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(g.rng, 4, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(g.rng, 4, utilities.LowerHexChars) + "-" + utilities.RandomStringFromCharset(g.rng, 12, utilities.LowerHexChars)
 	case "hex":
-		return utilities.RandomStringFromCharset(len, utilities.UpperHexChars)
+		return utilities.RandomStringFromCharset(g.rng, len, utilities.UpperHexChars)
 	case "alphanum":
-		return utilities.RandomStringFromCharset(len, utilities.MixedDigitChars)
+		return utilities.RandomStringFromCharset(g.rng, len, utilities.MixedDigitChars)
 	default:
 		return ""
 	}
 }
 
-func randomDate(format, start, end string) string {
+func (g *generator) randomDate(format, start, end string) string {
 	startTime, err := time.Parse(format, start)
 	if err != nil {
 		return ""
@@ -129,7 +139,7 @@ func randomDate(format, start, end string) string {
 		return startTime.Format(format)
 	}
 
-	randomTime := time.Unix(rand.Int63n(delta)+startUnix, 0)
+	randomTime := time.Unix(g.rng.Int63n(delta)+startUnix, 0)
 
 	return randomTime.Format(format)
 }
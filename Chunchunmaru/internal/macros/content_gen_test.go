@@ -1,10 +1,13 @@
 package macros
 
 import (
+	"chunchunmaru/internal/utilities"
 	"fmt"
 	"testing"
 )
 
+var testGen = newGenerator(42, utilities.AppConfig.GetConfig())
+
 func printTestResults(name, result interface{}) {
 	fmt.Printf("--- BENCHMARK FINISHED ---\n")
 	fmt.Printf("Function:    %s\n", name)
@@ -15,7 +18,7 @@ func printTestResults(name, result interface{}) {
 func BenchmarkMarkovSentence(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = markovSentence(24)
+		result = testGen.markovSentence(24)
 	}
 	printTestResults(b.Name(), result)
 }
@@ -23,63 +26,63 @@ func BenchmarkMarkovSentence(b *testing.B) {
 func BenchmarkMarkovParagraphs(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = markovParagraphs(10, 5, 20, 25, 50)
+		result = testGen.markovParagraphs(10, 5, 20, 25, 50)
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomWord(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomWord()
+		result = testGen.randomWord()
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomSentence(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomSentence(15)
+		result = testGen.randomSentence(15)
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomParagraphs(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomParagraphs(20, 5, 10, 20, 40)
+		result = testGen.randomParagraphs(20, 5, 10, 20, 40)
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomString(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomString("username", 19)
+		result = testGen.randomString("username", 19)
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomString2(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomString("email", 21)
+		result = testGen.randomString("email", 21)
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomString3(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomString("uuid", 13)
+		result = testGen.randomString("uuid", 13)
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomString4(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomString("hex", 8)
+		result = testGen.randomString("hex", 8)
 	}
 	printTestResults(b.Name(), result)
 }
 func BenchmarkRandomString5(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomString("alphanum", 24)
+		result = testGen.randomString("alphanum", 24)
 	}
 	printTestResults(b.Name(), result)
 }
@@ -0,0 +1,121 @@
+package macros
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultContentType Content type of pages whose template doesn't declare one
+const DefaultContentType = "text/html; charset=utf-8"
+
+// FrontMatter Settings a template declares in a YAML block between two "---" lines at the very top of the file:
+//
+//	---
+//	min_aggression: 50
+//	weight: 2
+//	tags: [heavy, svg]
+//	cache_control: no-store
+//	---
+type FrontMatter struct {
+	// MinAggression and MaxAggression The range of client aggression the template is served to
+	MinAggression int `yaml:"min_aggression"`
+	MaxAggression int `yaml:"max_aggression"`
+	// Weight How likely the template is to be picked relative to the others in range. Zero never picks it.
+	Weight float64  `yaml:"weight"`
+	Tags   []string `yaml:"tags"`
+	// ContentType The Content-Type the page is served with
+	ContentType string `yaml:"content_type"`
+	// CacheControl The Cache-Control header the page is served with, if any
+	CacheControl string `yaml:"cache_control"`
+	// Expires How far in the future the Expires header is set, if at all
+	Expires time.Duration `yaml:"expires"`
+}
+
+// DefaultFrontMatter Returns the settings of a template without front matter: any aggression, weight 1, served as HTML
+func DefaultFrontMatter() FrontMatter {
+	return FrontMatter{MaxAggression: 100, Weight: 1, ContentType: DefaultContentType}
+}
+
+// Matches Reports whether the template applies at aggression
+func (f FrontMatter) Matches(aggression int) bool {
+	return aggression >= f.MinAggression && aggression <= f.MaxAggression
+}
+
+// yamlLinePattern Matches the line number in yaml.v3 errors
+var yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+
+// SplitFrontMatter Separates a template's front matter from its body. The front matter is replaced by a template
+// comment over the same lines, so line numbers in parse errors still match the file. Errors are TemplateErrors.
+func SplitFrontMatter(content string) (FrontMatter, string, error) {
+	frontMatter := DefaultFrontMatter()
+	rest, ok := strings.CutPrefix(content, "---\n")
+	if !ok {
+		if rest, ok = strings.CutPrefix(content, "---\r\n"); !ok {
+			return frontMatter, content, nil
+		}
+	}
+	end := -1
+	for offset := 0; offset < len(rest); {
+		line, _, _ := strings.Cut(rest[offset:], "\n")
+		if strings.TrimRight(line, "\r") == "---" {
+			end = offset
+			break
+		}
+		offset += len(line) + 1
+	}
+	if end < 0 {
+		return frontMatter, content, TemplateError{Phase: "front matter", Line: 1, Message: "front matter is never closed by a --- line"}
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(rest[:end]))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&frontMatter); err != nil && !errors.Is(err, io.EOF) {
+		frontMatterErr := TemplateError{Phase: "front matter", Message: err.Error()}
+		if match := yamlLinePattern.FindStringSubmatch(err.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			// Counting the opening --- line
+			frontMatterErr.Line, frontMatterErr.Message = line+1, match[2]
+		}
+		return frontMatter, content, frontMatterErr
+	}
+	if err := frontMatter.validate(); err != nil {
+		return frontMatter, content, TemplateError{Phase: "front matter", Message: err.Error()}
+	}
+
+	// Swallow the front matter, including the newline after the closing ---
+	lines := strings.Count(content[:len(content)-len(rest)+end], "\n")
+	body := rest[end+len("---"):]
+	comment := "{{- /*" + strings.Repeat("\n", lines) + "*/ -}}"
+	return frontMatter, comment + body, nil
+}
+
+// validate Checks the front matter's values
+func (f FrontMatter) validate() error {
+	var problems []string
+	if f.MinAggression < 0 || f.MinAggression > 100 {
+		problems = append(problems, "min_aggression must be between 0 and 100")
+	}
+	if f.MaxAggression < f.MinAggression || f.MaxAggression > 100 {
+		problems = append(problems, "max_aggression must be between min_aggression and 100")
+	}
+	if f.Weight < 0 {
+		problems = append(problems, "weight must not be negative")
+	}
+	if f.Expires < 0 {
+		problems = append(problems, "expires must not be negative")
+	}
+	if f.ContentType == "" || strings.ContainsAny(f.ContentType, "\r\n") || strings.ContainsAny(f.CacheControl, "\r\n") {
+		problems = append(problems, "content_type and cache_control must be single-line header values")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package macros
+
+import (
+	"chunchunmaru/internal/utilities"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	content := "---\nmin_aggression: 40\ntags: [heavy]\nexpires: 1h\n---\n<p>{{ .Aggression }}</p>"
+	frontMatter, body, err := SplitFrontMatter(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frontMatter.MinAggression != 40 || frontMatter.MaxAggression != 100 || frontMatter.Weight != 1 ||
+		len(frontMatter.Tags) != 1 || frontMatter.Expires != time.Hour || frontMatter.ContentType != DefaultContentType {
+		t.Fatalf("unexpected front matter %+v", frontMatter)
+	}
+	if page := renderTestTemplate(t, body, 1); page != "<p>60</p>" {
+		t.Fatalf("front matter leaked into the page: %q", page)
+	}
+
+	// Errors in the body keep the line numbers of the file
+	errs := CheckTemplate("test.html", "---\nweight: 2\n---\n<p>\n{{ .Missing }}</p>", nil, utilities.DefaultConfig())
+	if len(errs) == 0 || errs[0].Line != 5 {
+		t.Fatalf("expected an error on line 5, got %+v", errs)
+	}
+
+	for content, line := range map[string]int{
+		"---\nweight: 2\nunknown: 1\n---\n":                  3,
+		"---\nweight: [\n---\n":                              2,
+		"---\nmin_aggression: 90\nmax_aggression: 10\n---\n": 0,
+		"---\nweight: 2\n":                                   1,
+	} {
+		_, _, err := SplitFrontMatter(content)
+		var templateErr TemplateError
+		if !errors.As(err, &templateErr) || templateErr.Phase != "front matter" || templateErr.Line != line {
+			t.Errorf("%q: expected a front matter error on line %d, got %v", content, line, err)
+		}
+	}
+}
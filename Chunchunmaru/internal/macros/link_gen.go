@@ -4,7 +4,6 @@ import (
 	"chunchunmaru/internal/utilities"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"slices"
 	"strings"
 )
@@ -12,46 +11,46 @@ import (
 // internalGenerateRandomJson creates a random JSON structure with a specified depth.
 // The returned interface{} can be a map[string]interface{}, a slice of interface{},
 // a string, an integer, or a boolean.
-func internalGenerateRandomJson(depth, maxElements, maxStringLength int) interface{} {
+func (g *generator) internalGenerateRandomJson(depth, maxElements, maxStringLength int) interface{} {
 	if depth <= 0 {
 		// Base case: return a random primitive type
-		switch rand.Intn(3) {
+		switch g.rng.Intn(3) {
 		case 0:
-			return utilities.RandomStringFromCharset(rand.Intn(maxStringLength)+1, utilities.MixedDigitChars)
+			return utilities.RandomStringFromCharset(g.rng, g.rng.Intn(maxStringLength)+1, utilities.MixedDigitChars)
 		case 1:
-			return rand.Intn(100)
+			return g.rng.Intn(100)
 		default:
-			return rand.Intn(2) == 1
+			return g.rng.Intn(2) == 1
 		}
 	}
 
 	// Recursive step: create a map or a slice
-	if rand.Intn(2) == 0 {
+	if g.rng.Intn(2) == 0 {
 		// Create a JSON object
 		obj := make(map[string]interface{})
-		numElements := rand.Intn(maxElements) + 1
+		numElements := g.rng.Intn(maxElements) + 1
 		for i := 0; i < numElements; i++ {
-			key := utilities.RandomStringFromCharset(5, utilities.MixedDigitChars)
-			obj[key] = internalGenerateRandomJson(depth-1, maxElements, maxStringLength)
+			key := utilities.RandomStringFromCharset(g.rng, 5, utilities.MixedDigitChars)
+			obj[key] = g.internalGenerateRandomJson(depth-1, maxElements, maxStringLength)
 		}
 		return obj
 	}
 
 	// Create a JSON array
 	arr := make([]interface{}, 0)
-	numElements := rand.Intn(maxElements) + 1
+	numElements := g.rng.Intn(maxElements) + 1
 	for i := 0; i < numElements; i++ {
-		arr = append(arr, internalGenerateRandomJson(depth-1, maxElements, maxStringLength))
+		arr = append(arr, g.internalGenerateRandomJson(depth-1, maxElements, maxStringLength))
 	}
 	return arr
 
 }
 
 // randomLink Provies a randomly generated URL
-func randomLink() string {
-	config := utilities.AppConfig.GetConfig()
-	word := randomWord()
-	for ; slices.Contains(config.PathWhitelist, "/"+word); word = randomWord() {
+func (g *generator) randomLink() string {
+	config := g.config
+	word := g.randomWord()
+	for ; slices.Contains(config.PathWhitelist, "/"+word); word = g.randomWord() {
 		// Logic is in the loop header lmao
 	}
 
@@ -60,29 +59,32 @@ func randomLink() string {
 	builder.WriteString("/")
 	builder.WriteString(word)
 	builder.WriteString("/")
-	pathNum := rand.Intn(config.MaxSubpaths-config.MinSubpaths) + config.MinSubpaths - 1
+	pathNum := config.MinSubpaths - 1
+	if span := config.MaxSubpaths - config.MinSubpaths; span > 0 {
+		pathNum += g.rng.Intn(span)
+	}
 	for _ = range pathNum {
-		builder.WriteString(randomWord())
+		builder.WriteString(g.randomWord())
 		builder.WriteString("/")
 	}
 	return builder.String()
 }
 
 // randomQueryLink Provides a randomly generated query URL
-func randomQueryLink(keyCount int) string {
+func (g *generator) randomQueryLink(keyCount int) string {
 	if keyCount == 1 {
-		return randomLink() + "?" + randomWord() + "=" + utilities.RandomStringFromCharset(rand.Intn(16)+5, utilities.AlphabetChars)
+		return g.randomLink() + "?" + g.randomWord() + "=" + utilities.RandomStringFromCharset(g.rng, g.rng.Intn(16)+5, utilities.AlphabetChars)
 	} else {
 		var builder strings.Builder
-		builder.WriteString(randomLink())
+		builder.WriteString(g.randomLink())
 		builder.WriteString("?")
 		for i := 0; i < keyCount; i++ {
 			if i != 0 {
 				builder.WriteString("&")
 			}
-			builder.WriteString(randomWord())
+			builder.WriteString(g.randomWord())
 			builder.WriteByte('=')
-			builder.WriteString(utilities.RandomStringFromCharset(rand.Intn(16)+5, utilities.AlphabetChars))
+			builder.WriteString(utilities.RandomStringFromCharset(g.rng, g.rng.Intn(16)+5, utilities.AlphabetChars))
 		}
 
 		return builder.String()
@@ -90,12 +92,12 @@ func randomQueryLink(keyCount int) string {
 }
 
 // randomJSON Generates a random nested JSON object
-func randomJSON(depth, maxElements, maxStringLength int) (string, error) {
+func (g *generator) randomJSON(depth, maxElements, maxStringLength int) (string, error) {
 	if depth < 0 {
 		return "", fmt.Errorf("depth cannot be negative")
 	}
 
-	randomData := internalGenerateRandomJson(depth, maxElements, maxStringLength)
+	randomData := g.internalGenerateRandomJson(depth, maxElements, maxStringLength)
 
 	jsonData, err := json.MarshalIndent(randomData, "", "  ")
 	if err != nil {
@@ -1,13 +1,15 @@
 package macros
 
 import (
+	"chunchunmaru/internal/utilities"
+	"strings"
 	"testing"
 )
 
 func BenchmarkRandomLink(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomLink()
+		result = testGen.randomLink()
 	}
 	printTestResults(b.Name(), result)
 }
@@ -15,7 +17,7 @@ func BenchmarkRandomLink(b *testing.B) {
 func BenchmarkRandomQueryLink(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result = randomQueryLink(10)
+		result = testGen.randomQueryLink(10)
 	}
 	printTestResults(b.Name(), result)
 }
@@ -23,7 +25,16 @@ func BenchmarkRandomQueryLink(b *testing.B) {
 func BenchmarkRandomJSON(b *testing.B) {
 	var result interface{}
 	for i := 0; i < b.N; i++ {
-		result, _ = randomJSON(5, 5, 20)
+		result, _ = testGen.randomJSON(5, 5, 20)
 	}
 	printTestResults(b.Name(), result)
 }
+
+func TestRandomLinkFixedDepth(t *testing.T) {
+	config := utilities.DefaultConfig()
+	config.MinSubpaths, config.MaxSubpaths = 3, 3
+	link := newGenerator(1, config).randomLink()
+	if depth := strings.Count(strings.TrimPrefix(link, config.HostName), "/") - 1; depth != 3 {
+		t.Fatalf("expected 3 path segments in %s, got %d", link, depth)
+	}
+}
@@ -1,12 +1,17 @@
 package macros
 
 import (
-	"math/rand"
+	"errors"
+	"fmt"
 	"reflect"
 )
 
-func randomInt(min, max int) int {
-	return min + rand.Intn(max-min)
+// randomInt Returns a number from min up to but not including max, or min if the range is empty
+func (g *generator) randomInt(min, max int) int {
+	if span := max - min; span > 0 {
+		return min + g.rng.Intn(span)
+	}
+	return min
 }
 
 func repeat(count int) []int {
@@ -24,7 +29,23 @@ func list(args ...interface{}) []interface{} {
 	return args
 }
 
-func randomChoice(slice interface{}) interface{} {
+// dict Builds a map from alternating keys and values, for passing named arguments to partials
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict needs an even number of arguments")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+func (g *generator) randomChoice(slice interface{}) interface{} {
 	if slice == nil {
 		return nil
 	}
@@ -34,7 +55,7 @@ func randomChoice(slice interface{}) interface{} {
 		return nil
 	}
 
-	return val.Index(rand.Intn(val.Len())).Interface()
+	return val.Index(g.rng.Intn(val.Len())).Interface()
 }
 
 func add(a, b int) int {
@@ -1,6 +1,7 @@
 package macros
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -8,7 +9,7 @@ func BenchmarkRandomInt(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomInt(0, 100)
+		result = testGen.randomInt(0, 100)
 	}
 
 	printTestResults(b.Name(), result)
@@ -38,8 +39,22 @@ func BenchmarkRandomChoice(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomChoice([]interface{}{"penis", 1, 5, 71.0, "wow"})
+		result = testGen.randomChoice([]interface{}{"penis", 1, 5, 71.0, "wow"})
 	}
 
 	printTestResults(b.Name(), result)
 }
+
+func TestRandomIntEmptyRange(t *testing.T) {
+	if n := testGen.randomInt(5, 5); n != 5 {
+		t.Fatalf("expected 5 from an empty range, got %d", n)
+	}
+	if n := testGen.randomInt(5, 3); n != 5 {
+		t.Fatalf("expected min from a reversed range, got %d", n)
+	}
+	// Equal bounds give exactly that many sentences of that length
+	if paragraph := testGen.randomParagraphs(1, 2, 2, 3, 3); len(strings.Fields(paragraph)) != 6 {
+		t.Fatalf("expected two sentences of three words, got %q", paragraph)
+	}
+	testGen.markovParagraphs(1, 2, 2, 3, 3)
+}
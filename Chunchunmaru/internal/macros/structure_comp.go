@@ -2,22 +2,21 @@ package macros
 
 import (
 	"html/template"
-	"math/rand"
 	"strings"
 )
 
 var types = [5]string{"text", "radio", "checkbox", "submit", "button"}
 
-func randomForm(count, styleCount int) template.HTML {
+func (g *generator) randomForm(count, styleCount int) template.HTML {
 	var builder strings.Builder
 	builder.WriteString("<form>\n")
 
 	for i := 0; i < count; i++ {
-		id := randomId("input", 5)
+		id := g.randomId("input", 5)
 
 		// Input
 		builder.WriteString("<input type=\"")
-		builder.WriteString(types[rand.Intn(len(types))]) // Input type
+		builder.WriteString(types[g.rng.Intn(len(types))]) // Input type
 		builder.WriteString("\" id=\"")
 		builder.WriteString(id) // ID of element
 		builder.WriteString("\">\n")
@@ -26,9 +25,9 @@ func randomForm(count, styleCount int) template.HTML {
 		builder.WriteString("<label for=\"")
 		builder.WriteString(id) // ID of element label will use
 		builder.WriteString("\" ")
-		builder.WriteString(string(randomInlineStyle(rand.Intn(styleCount)))) // Random CSS garbage
+		builder.WriteString(string(g.randomInlineStyle(g.rng.Intn(styleCount)))) // Random CSS garbage
 		builder.WriteString(">")
-		builder.WriteString(randomWord()) // Random label word
+		builder.WriteString(g.randomWord()) // Random label word
 		builder.WriteString("</label>\n")
 	}
 	builder.WriteString("</form>")
@@ -40,12 +39,12 @@ type definition struct {
 	Def  string
 }
 
-func randomDefinitionData(count, len int) []definition {
+func (g *generator) randomDefinitionData(count, len int) []definition {
 	arr := make([]definition, count)
 	for i := 0; i < count; i++ {
 		arr[i] = definition{
-			Term: randomWord(),
-			Def:  randomSentence(len),
+			Term: g.randomWord(),
+			Def:  g.randomSentence(len),
 		}
 	}
 	return arr
@@ -8,7 +8,7 @@ func BenchmarkRandomForm(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomForm(10, 12)
+		result = testGen.randomForm(10, 12)
 	}
 
 	printTestResults(b.Name(), result)
@@ -18,7 +18,7 @@ func BenchmarkRandomDefinitionData(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomDefinitionData(10, 12)
+		result = testGen.randomDefinitionData(10, 12)
 	}
 
 	printTestResults(b.Name(), result)
@@ -3,30 +3,29 @@ package macros
 import (
 	"chunchunmaru/internal/utilities"
 	"html/template"
-	"math/rand"
 	"strings"
 )
 
 var classNames = [11]string{"mx-auto", "flex", "max-w-sm", "items-center", "gap-x-4", "rounded-xl", "bg-white", "p-6", "shadow-lg", "outline", "outline-black"}
 
 // randomColor Fetches a random hex color
-func randomColor() string {
-	return utilities.RandomHexColor()
+func (g *generator) randomColor() string {
+	return utilities.RandomHexColor(g.rng)
 }
 
 // randomId Fetches a random HTML element ID
-func randomId(prefix string, length int) string {
-	return utilities.RandomStringFromCharset(length, prefix+"-"+utilities.MixedDigitChars)
+func (g *generator) randomId(prefix string, length int) string {
+	return utilities.RandomStringFromCharset(g.rng, length, prefix+"-"+utilities.MixedDigitChars)
 }
 
 // randomClasses Fetches random CSS classes and returns them in a string
-func randomClasses(count int) template.CSS {
+func (g *generator) randomClasses(count int) template.CSS {
 	var builder strings.Builder
 	for i := 0; i < count; i++ {
 		if i == count-1 {
-			builder.WriteString(classNames[rand.Intn(len(classNames))])
+			builder.WriteString(classNames[g.rng.Intn(len(classNames))])
 		} else {
-			builder.WriteString(classNames[rand.Intn(len(classNames))])
+			builder.WriteString(classNames[g.rng.Intn(len(classNames))])
 			builder.WriteString(" ")
 		}
 	}
@@ -34,11 +33,11 @@ func randomClasses(count int) template.CSS {
 }
 
 // randomInlineStyle Provides a full HTML style tag with random style data
-func randomInlineStyle(length int) template.CSS {
+func (g *generator) randomInlineStyle(length int) template.CSS {
 	var builder strings.Builder
 	builder.WriteString("style=\"")
 	for i := 0; i < length; i++ {
-		builder.WriteString(utilities.GenerateRandomInlineCSS())
+		builder.WriteString(utilities.GenerateRandomInlineCSS(g.rng))
 	}
 	builder.WriteString("\"")
 
@@ -46,14 +45,14 @@ func randomInlineStyle(length int) template.CSS {
 }
 
 // randomCSSStyle
-func randomCSSStyle(length int) template.CSS {
+func (g *generator) randomCSSStyle(length int) template.CSS {
 	if length == 1 {
-		return template.CSS(utilities.GenerateRandomInlineCSS())
+		return template.CSS(utilities.GenerateRandomInlineCSS(g.rng))
 	}
 	var builder strings.Builder
 
 	for i := 0; i < length; i++ {
-		builder.WriteString(utilities.GenerateRandomInlineCSS())
+		builder.WriteString(utilities.GenerateRandomInlineCSS(g.rng))
 	}
 
 	return template.CSS(builder.String())
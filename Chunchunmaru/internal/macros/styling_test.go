@@ -6,7 +6,7 @@ func BenchmarkRandomColor(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomColor()
+		result = testGen.randomColor()
 	}
 
 	printTestResults(b.Name(), result)
@@ -16,7 +16,7 @@ func BenchmarkRandomId(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomId("test", 10)
+		result = testGen.randomId("test", 10)
 	}
 
 	printTestResults(b.Name(), result)
@@ -26,7 +26,7 @@ func BenchmarkRandomClasses(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomClasses(5)
+		result = testGen.randomClasses(5)
 	}
 
 	printTestResults(b.Name(), result)
@@ -36,7 +36,7 @@ func BenchmarkRandomCSSStyle(b *testing.B) {
 	var result interface{}
 
 	for i := 0; i < b.N; i++ {
-		result = randomCSSStyle(10)
+		result = testGen.randomCSSStyle(10)
 	}
 
 	printTestResults(b.Name(), result)
@@ -1,61 +1,114 @@
 package macros
 
 import (
+	"chunchunmaru/internal/utilities"
 	"html/template"
+	"math/rand"
 )
 
-var funcMap = template.FuncMap{
-	// Category 1: Content Generation
-	"markovSentence":   markovSentence,
-	"markovParagraphs": markovParagraphs,
-	"randomParagraphs": randomParagraphs,
-	"randomSentence":   randomSentence,
-	"randomWord":       randomWord,
-	"randomString":     randomString,
-	"randomDate":       randomDate,
-
-	// Category 2: Structure & Composition
-	"randomForm":           randomForm,
-	"randomDefinitionData": randomDefinitionData,
-
-	// Category 3: Styling
-	"randomColor":       randomColor,
-	"randomId":          randomId,
-	"randomClasses":     randomClasses,
-	"randomInlineStyle": randomInlineStyle,
-	"randomCSSStyle":    randomCSSStyle,
-
-	// Category 4: Link & Navigation
-	"randomLink":      randomLink,
-	"randomQueryLink": randomQueryLink,
-	"randomJSON":      randomJSON,
-
-	// Category 5: Logic & Control
-	"randomInt":    randomInt,
-	"repeat":       repeat,
-	"list":         list,
-	"randomChoice": randomChoice,
-	"add":          add,
-	"sub":          sub,
-	"div":          div,
-	"mult":         mult,
-	"max":          max,
-	"min":          min,
-
-	// Category 6: Computationally Expensive & Anti-Extraction
-	"nestDivs":             nestDivs,
-	"randomComplexTable":   randomComplexTable,
-	"randomStyleBlock":     randomStyleBlock,
-	"randomSVG":            randomSVG,
-	"randomCSSVars":        randomCSSVars,
-	"jsInteractiveContent": jsInteractiveContent,
+// generator Holds the random source every macro of a single render draws from, so that a page built from the same
+// seed always comes out identical, along with the config the page is rendered under.
+type generator struct {
+	rng    *rand.Rand
+	config utilities.Config
+}
+
+func newGenerator(seed int64, config utilities.Config) *generator {
+	return &generator{rng: rand.New(rand.NewSource(seed)), config: config}
+}
+
+// funcMap Returns the macro library bound to this generator
+func (g *generator) funcMap() template.FuncMap {
+	return template.FuncMap{
+		// Category 1: Content Generation
+		"markovSentence":       g.markovSentence,
+		"markovSentenceFrom":   g.markovSentenceFrom,
+		"markovParagraphs":     g.markovParagraphs,
+		"markovParagraphsFrom": g.markovParagraphsFrom,
+		"randomParagraphs":     g.randomParagraphs,
+		"randomSentence":       g.randomSentence,
+		"randomWord":           g.randomWord,
+		"randomString":         g.randomString,
+		"randomDate":           g.randomDate,
+
+		// Category 2: Structure & Composition
+		"randomForm":           g.randomForm,
+		"randomDefinitionData": g.randomDefinitionData,
+
+		// Category 3: Styling
+		"randomColor":       g.randomColor,
+		"randomId":          g.randomId,
+		"randomClasses":     g.randomClasses,
+		"randomInlineStyle": g.randomInlineStyle,
+		"randomCSSStyle":    g.randomCSSStyle,
+
+		// Category 4: Link & Navigation
+		"randomLink":      g.randomLink,
+		"randomQueryLink": g.randomQueryLink,
+		"randomJSON":      g.randomJSON,
+
+		// Category 5: Logic & Control
+		"randomInt":    g.randomInt,
+		"repeat":       repeat,
+		"list":         list,
+		"dict":         dict,
+		"randomChoice": g.randomChoice,
+		"add":          add,
+		"sub":          sub,
+		"div":          div,
+		"mult":         mult,
+		"max":          max,
+		"min":          min,
+
+		// Category 6: Computationally Expensive & Anti-Extraction
+		"nestDivs":             g.nestDivs,
+		"randomComplexTable":   g.randomComplexTable,
+		"randomStyleBlock":     g.randomStyleBlock,
+		"randomSVG":            g.randomSVG,
+		"randomCSSVars":        g.randomCSSVars,
+		"jsInteractiveContent": g.jsInteractiveContent,
+	}
 }
 
 type TemplateInput struct {
 	Aggression int
+	Seed       int64
+}
+
+// BuildTemplate Parses a template on a copy of base, the set of partials and layouts from ParseBase or nil for none,
+// with macros that all draw from a random source seeded with seed and generate links according to config.
+func BuildTemplate(name, content string, base *template.Template, seed int64, config utilities.Config) (*template.Template, error) {
+	_, body, err := SplitFrontMatter(content)
+	if err != nil {
+		return nil, err
+	}
+	page, err := newPage(base, name)
+	if err != nil {
+		return nil, err
+	}
+	return bind(page, seed, config).Parse(body)
+}
+
+// ParseTemplate Parses a template once on a copy of base, so it can be handed out to many requests by Instantiate. The
+// returned template must not be executed itself.
+func ParseTemplate(name, content string, base *template.Template) (*template.Template, error) {
+	_, body, err := SplitFrontMatter(content)
+	if err != nil {
+		return nil, err
+	}
+	page, err := newPage(base, name)
+	if err != nil {
+		return nil, err
+	}
+	return page.Parse(body)
 }
 
-func BuildTemplate(name, content string) (*template.Template, error) {
-	tmp, err := template.New(name).Funcs(funcMap).Parse(content)
-	return tmp, err
+// Instantiate Returns a copy of a template from ParseTemplate whose macros draw from a random source seeded with seed
+// and generate links according to config.
+func Instantiate(parsed *template.Template, seed int64, config utilities.Config) (*template.Template, error) {
+	page, err := parsed.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return bind(page, seed, config), nil
 }
@@ -1 +1,122 @@
 package macros
+
+import (
+	"chunchunmaru/internal/utilities"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func renderTestTemplate(t *testing.T, content string, seed int64) string {
+	return renderOnBase(t, nil, content, seed)
+}
+
+// readTestBase Parses the partials and layouts shipped in the templates directory, which the shipped pages are built on
+func readTestBase(t *testing.T) *template.Template {
+	files := make(map[string]string)
+	for _, sub := range []string{PartialsDir, LayoutsDir} {
+		paths, err := filepath.Glob(filepath.Join("../../templates", sub, "*.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[sub+"/"+strings.TrimSuffix(filepath.Base(path), ".html")] = string(content)
+		}
+	}
+	base, err := ParseBase(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base
+}
+
+func renderOnBase(t *testing.T, base *template.Template, content string, seed int64) string {
+	tmpl, err := BuildTemplate("test", content, base, seed, utilities.AppConfig.GetConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, TemplateInput{Aggression: 60, Seed: seed}); err != nil {
+		t.Fatal(err)
+	}
+	return builder.String()
+}
+
+func TestBuildTemplateDeterministic(t *testing.T) {
+	content, err := os.ReadFile("../../templates/easy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := readTestBase(t)
+	first := renderOnBase(t, base, string(content), 1234)
+	if second := renderOnBase(t, base, string(content), 1234); first != second {
+		t.Fatal("same seed rendered different pages")
+	}
+	if other := renderOnBase(t, base, string(content), 4321); first == other {
+		t.Fatal("different seeds rendered the same page")
+	}
+}
+
+func TestRenderPreviewTiers(t *testing.T) {
+	content, err := os.ReadFile("../../templates/easy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// easy.html declares no tiers itself, they come from the layout it calls
+	base := readTestBase(t)
+	preview, err := RenderPreview("easy.html", string(content), base, 60, 1234, utilities.AppConfig.GetConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !preview.Tiers["$tier2"] || !preview.Tiers["$tier3"] || preview.Tiers["$tier4"] {
+		t.Fatalf("unexpected tiers at aggression 60: %v", preview.Tiers)
+	}
+	if preview.MacroCalls["nestDivs"] == 0 || preview.HTML != renderOnBase(t, base, string(content), 1234) {
+		t.Fatalf("preview differs from the page the tarpit would serve, calls %v", preview.MacroCalls)
+	}
+}
+
+func TestBuildTemplateOnBase(t *testing.T) {
+	set, err := ParseBase(map[string]string{
+		"partials/greeting": `<b>{{.Name}}</b>{{if .Tail}} {{.Tail}}{{end}}`,
+		"partials/pair":     `{{index . 0}}-{{index . 1}}`,
+		"layouts/page":      `<h1>{{block "title" .}}untitled{{end}}</h1>{{block "content" .}}{{end}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := `{{define "title"}}{{template "partials/greeting" (dict "Name" "<x>" "Tail" "")}}{{end}}` +
+		`{{define "content"}}{{partial "pair" 1 2}} {{partial "greeting" (dict "Name" "y" "Tail" "z")}}{{end}}` +
+		`{{template "layouts/page" .}}`
+	want := `<h1><b>&lt;x&gt;</b></h1>1-2 <b>y</b> z`
+	for seed := int64(0); seed < 2; seed++ {
+		// Each page gets its own copy of the base set, so the same blocks can be defined again
+		if page := renderOnBase(t, set, content, seed); page != want {
+			t.Fatalf("expected %q, got %q", want, page)
+		}
+	}
+
+	// Other sets are unaffected by set
+	tmpl, err := BuildTemplate("test", content, nil, 0, utilities.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.Execute(io.Discard, TemplateInput{}); err == nil {
+		t.Fatal("expected a page without the base set to miss its layout")
+	}
+
+	if _, err := ParseBase(map[string]string{"partials/broken": "{{ end }}"}); err == nil {
+		t.Fatal("expected a parse error")
+	} else if templateErr, ok := err.(TemplateError); !ok || templateErr.Name != "partials/broken" || templateErr.Line != 1 {
+		t.Fatalf("expected the error to name the partial, got %#v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package macros
+
+import (
+	"chunchunmaru/internal/utilities"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// TrialAggressions Aggression levels a template is rendered at by CheckTemplate
+var TrialAggressions = []int{0, 50, 100}
+
+// TemplateError A problem found while parsing or rendering a template. Line and Column are 0 when unknown.
+type TemplateError struct {
+	// Name The template the error is in, when known
+	Name string
+	// Phase "front matter", "parse" or "execute"
+	Phase string
+	// Aggression The trial aggression the error came up at, for execute errors
+	Aggression int
+	Line       int
+	Column     int
+	Message    string
+}
+
+func (e TemplateError) Error() string {
+	if e.Line == 0 {
+		return e.Phase + ": " + e.Message
+	}
+	return fmt.Sprintf("%s: line %d: %s", e.Phase, e.Line, e.Message)
+}
+
+// templateErrorPattern Matches the "template: name:line:column: message" form of text/template errors
+var templateErrorPattern = regexp.MustCompile(`^template: (.*?):(\d+)(?::(\d+))?: (.*)$`)
+
+// newTemplateError Splits err into its position and message
+func newTemplateError(phase string, aggression int, err error) TemplateError {
+	templateError := TemplateError{Phase: phase, Aggression: aggression, Message: err.Error()}
+	if match := templateErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		templateError.Name = match[1]
+		templateError.Line, _ = strconv.Atoi(match[2])
+		templateError.Column, _ = strconv.Atoi(match[3])
+		templateError.Message = match[4]
+	}
+	return templateError
+}
+
+// CheckTemplate Parses content on base with BuildTemplate and renders it at each of TrialAggressions, returning every
+// error found. A template that doesn't parse is not rendered.
+func CheckTemplate(name, content string, base *template.Template, config utilities.Config) []TemplateError {
+	var errs []TemplateError
+	for _, aggression := range TrialAggressions {
+		seed := int64(aggression)
+		tmpl, err := BuildTemplate(name, content, base, seed, config)
+		if err != nil {
+			var frontMatterErr TemplateError
+			if errors.As(err, &frontMatterErr) {
+				return []TemplateError{frontMatterErr}
+			}
+			return []TemplateError{newTemplateError("parse", 0, err)}
+		}
+		if err := tmpl.Execute(io.Discard, TemplateInput{Aggression: aggression, Seed: seed}); err != nil {
+			errs = append(errs, newTemplateError("execute", aggression, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,128 @@
+package macros
+
+import (
+	"chunchunmaru/internal/utilities"
+	"html/template"
+	"reflect"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+// Preview A page rendered by RenderPreview, with what went into it
+type Preview struct {
+	HTML     string
+	Duration time.Duration
+	// MacroCalls How many times each macro was called
+	MacroCalls map[string]int
+	// Tiers The template's top-level $tier variables and whether each was true
+	Tiers map[string]bool
+	// FrontMatter The template's declared settings
+	FrontMatter FrontMatter
+}
+
+// countCalls Returns funcs wrapped to count their calls in counts. Templates execute on one goroutine, so counts is
+// not locked.
+func countCalls(funcs template.FuncMap, counts map[string]int) template.FuncMap {
+	counted := make(template.FuncMap, len(funcs))
+	for name, fn := range funcs {
+		value := reflect.ValueOf(fn)
+		counted[name] = reflect.MakeFunc(value.Type(), func(args []reflect.Value) []reflect.Value {
+			counts[name]++
+			if value.Type().IsVariadic() {
+				return value.CallSlice(args)
+			}
+			return value.Call(args)
+		}).Interface()
+	}
+	return counted
+}
+
+// RenderPreview Renders content at aggression the way the tarpit would for seed, without any delays, and reports how
+// long it took, which macros it called and which tiers were active. Partials and layouts come from base, as for
+// BuildTemplate. Errors are TemplateErrors.
+func RenderPreview(name, content string, base *template.Template, aggression int, seed int64, config utilities.Config) (Preview, error) {
+	preview := Preview{MacroCalls: make(map[string]int)}
+	input := TemplateInput{Aggression: aggression, Seed: seed}
+	frontMatter, body, err := SplitFrontMatter(content)
+	if err != nil {
+		return preview, err
+	}
+	preview.FrontMatter = frontMatter
+	tmpl, err := newPage(base, name)
+	if err != nil {
+		return preview, err
+	}
+	funcs := newGenerator(seed, config).funcMap()
+	funcs["partial"] = partialFunc(tmpl)
+	if _, err = tmpl.Funcs(countCalls(funcs, preview.MacroCalls)).Parse(body); err != nil {
+		return preview, newTemplateError("parse", 0, err)
+	}
+
+	var builder strings.Builder
+	started := time.Now()
+	err = tmpl.Execute(&builder, input)
+	preview.Duration = time.Since(started)
+	if err != nil {
+		return preview, newTemplateError("execute", aggression, err)
+	}
+	preview.HTML = builder.String()
+	preview.Tiers = activeTiers(tmpl, base, input, config)
+	return preview, nil
+}
+
+// activeTiers Evaluates the $tier variables declared at the top level of tmpl, such as {{ $tier2 := ge $aggression 25 }},
+// and at the top level of the layouts tmpl calls there, which are given the same input. The declarations before them
+// are evaluated too, with a separate random source so the page itself is unaffected.
+func activeTiers(tmpl, base *template.Template, input TemplateInput, config utilities.Config) map[string]bool {
+	tiers := make(map[string]bool)
+	if tmpl.Tree == nil {
+		return tiers
+	}
+	trees := []*parse.Tree{tmpl.Tree}
+	for _, node := range tmpl.Tree.Root.Nodes {
+		if call, ok := node.(*parse.TemplateNode); ok {
+			if layout := tmpl.Lookup(call.Name); layout != nil && layout.Tree != nil {
+				trees = append(trees, layout.Tree)
+			}
+		}
+	}
+	for _, tree := range trees {
+		evaluateTiers(tree, tiers, base, input, config)
+	}
+	return tiers
+}
+
+// evaluateTiers Adds the $tier variables declared at the top level of tree to tiers, set if they are true for input
+func evaluateTiers(tree *parse.Tree, tiers map[string]bool, base *template.Template, input TemplateInput, config utilities.Config) {
+	var declarations, checks strings.Builder
+	for _, node := range tree.Root.Nodes {
+		action, ok := node.(*parse.ActionNode)
+		if !ok || len(action.Pipe.Decl) != 1 || action.Pipe.IsAssign {
+			continue
+		}
+		declarations.WriteString(action.String())
+		if variable := action.Pipe.Decl[0].Ident[0]; strings.HasPrefix(variable, "$tier") {
+			tiers[variable] = false
+			checks.WriteString("{{if " + variable + "}}" + variable + "\n{{end}}")
+		}
+	}
+	if checks.Len() == 0 {
+		return
+	}
+
+	evaluator, err := newPage(base, "tiers")
+	if err != nil {
+		return
+	}
+	if _, err = bind(evaluator, input.Seed, config).Parse(declarations.String() + checks.String()); err != nil {
+		return
+	}
+	var active strings.Builder
+	if err := evaluator.Execute(&active, input); err != nil {
+		return
+	}
+	for _, variable := range strings.Fields(active.String()) {
+		tiers[variable] = true
+	}
+}
@@ -0,0 +1,82 @@
+package macros
+
+import (
+	"chunchunmaru/internal/utilities"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// Directories under the templates directory holding shared templates. A file partials/nav.html is available to every
+// page as the template "partials/nav", and layouts/page.html as "layouts/page".
+const (
+	PartialsDir = "partials"
+	LayoutsDir  = "layouts"
+)
+
+// newSet Returns an empty set that knows the names of every macro
+func newSet() *template.Template {
+	funcs := newGenerator(0, utilities.Config{}).funcMap()
+	funcs["partial"] = partialFunc(nil)
+	return template.New("").Funcs(funcs)
+}
+
+// ParseBase Parses shared templates into a base set for pages to be parsed on. files maps names such as "partials/nav"
+// to their source.
+func ParseBase(files map[string]string) (*template.Template, error) {
+	set := newSet()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := set.New(name).Parse(files[name]); err != nil {
+			return nil, newTemplateError("parse", 0, err)
+		}
+	}
+	return set, nil
+}
+
+// newPage Returns an empty template called name in a copy of base, or in an empty set if base is nil
+func newPage(base *template.Template, name string) (*template.Template, error) {
+	if base == nil {
+		return newSet().New(name), nil
+	}
+	set, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return set.New(name), nil
+}
+
+// bind Binds the macros of a page and the partials it uses to a random source seeded with seed
+func bind(page *template.Template, seed int64, config utilities.Config) *template.Template {
+	return page.Funcs(newGenerator(seed, config).funcMap()).Funcs(template.FuncMap{"partial": partialFunc(page)})
+}
+
+// partialFunc Returns the partial macro for page. {{ partial "nav" args... }} renders partials/nav with no data, the
+// single argument or a list of the arguments, for use like any other macro.
+func partialFunc(page *template.Template) func(name string, args ...interface{}) (template.HTML, error) {
+	return func(name string, args ...interface{}) (template.HTML, error) {
+		if page == nil {
+			return "", errors.New("partial called outside a page")
+		}
+		var data interface{}
+		switch len(args) {
+		case 0:
+		case 1:
+			data = args[0]
+		default:
+			data = args
+		}
+		var builder strings.Builder
+		if err := page.ExecuteTemplate(&builder, PartialsDir+"/"+name, data); err != nil {
+			return "", fmt.Errorf("partial %q: %w", name, err)
+		}
+		// The partial was escaped when it ran, so it goes into the page as is
+		return template.HTML(builder.String()), nil
+	}
+}
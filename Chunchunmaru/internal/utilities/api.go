@@ -1,5 +1,7 @@
 package utilities
 
+import "time"
+
 // ApiBaseInfoReply OUTPUT: Defines data the server sends to the client regarding general server information.
 type ApiBaseInfoReply struct {
 	AppVersion string  `json:"appVersion"`
@@ -10,9 +12,27 @@ type ApiBaseInfoReply struct {
 
 // ApiTemplateInfoReply OUTPUT: Defines data the server sends to the client regarding template information.
 type ApiTemplateInfoReply struct {
-	FileNames      []string `json:"fileNames"`
-	Count          int      `json:"count"`
-	TotalDiskUsage int64    `json:"totalDiskUsage"`
+	FileNames      []string              `json:"fileNames"`
+	Count          int                   `json:"count"`
+	TotalDiskUsage int64                 `json:"totalDiskUsage"`
+	Templates      []ApiTemplateFileInfo `json:"templates,omitempty"`
+}
+
+// ApiTemplateFileInfo OUTPUT: One template known to the template registry and the settings from its front matter.
+// Expires is in seconds. Error is set when the file on disk failed to parse, in which case the previous version is
+// served if there was one.
+type ApiTemplateFileInfo struct {
+	FileName      string    `json:"fileName"`
+	Size          int64     `json:"size"`
+	Modified      time.Time `json:"modified"`
+	MinAggression int       `json:"minAggression"`
+	MaxAggression int       `json:"maxAggression"`
+	Weight        float64   `json:"weight"`
+	Tags          []string  `json:"tags"`
+	ContentType   string    `json:"contentType"`
+	CacheControl  string    `json:"cacheControl,omitempty"`
+	Expires       float64   `json:"expires,omitempty"`
+	Error         string    `json:"error,omitempty"`
 }
 
 type ApiQueryInfoReply struct {
@@ -20,15 +40,49 @@ type ApiQueryInfoReply struct {
 }
 
 type IpInfoStruct struct {
-	Ip         string `json:"ip"`
-	Queries    int    `json:"queries"`
-	Aggression int    `json:"aggression"`
+	Ip         string  `json:"ip"`
+	Queries    int     `json:"queries"`
+	Aggression int     `json:"aggression"`
+	Rate       float64 `json:"rate"`
+	LastSeen   int64   `json:"lastSeen"`
 }
 
 type UserAgentInfoStruct struct {
-	UserAgent  string `json:"userAgent"`
-	Queries    int    `json:"queries"`
-	Aggression int    `json:"aggression"`
+	UserAgent  string  `json:"userAgent"`
+	Queries    int     `json:"queries"`
+	Aggression int     `json:"aggression"`
+	Rate       float64 `json:"rate"`
+	LastSeen   int64   `json:"lastSeen"`
+}
+
+// AggregateInfoStruct OUTPUT: Defines the reputation of a subnet or ASN that many clients are aggregated into.
+type AggregateInfoStruct struct {
+	Key        string  `json:"key"`
+	Queries    int     `json:"queries"`
+	Aggression int     `json:"aggression"`
+	Rate       float64 `json:"rate"`
+	LastSeen   int64   `json:"lastSeen"`
+}
+
+// ApiRequestLogEntry OUTPUT: Defines one request from the request log.
+type ApiRequestLogEntry struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query"`
+	Template   string    `json:"template"`
+	Aggression int       `json:"aggression"`
+	Delay      float64   `json:"delay"`
+	Bytes      int64     `json:"bytes"`
+}
+
+// ApiRequestLogReply OUTPUT: Defines a page of the request log, newest first. Request the next page with offset+limit.
+type ApiRequestLogReply struct {
+	Requests []ApiRequestLogEntry `json:"requests"`
+	Limit    int                  `json:"limit"`
+	Offset   int                  `json:"offset"`
 }
 
 // ApiUploadTemplateData INPUT: Defines data the client needs to send to the server to create a new template.
@@ -37,11 +91,79 @@ type ApiUploadTemplateData struct {
 	ContentBase64 string `json:"contentBase64"`
 }
 
+// ApiTemplateError OUTPUT: A parse or trial render error in a template. Line and column are 0 when unknown.
+type ApiTemplateError struct {
+	Phase      string `json:"phase"`
+	Aggression int    `json:"aggression,omitempty"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	Message    string `json:"message"`
+}
+
+// ApiUploadTemplateReply OUTPUT: Whether an uploaded template was saved, and if not, why.
+type ApiUploadTemplateReply struct {
+	FileName string             `json:"fileName"`
+	Saved    bool               `json:"saved"`
+	Message  string             `json:"message"`
+	Errors   []ApiTemplateError `json:"errors"`
+}
+
+// ApiRenderTemplateData INPUT: A template to preview, by name or as inline source, and the aggression to render it at.
+// A random seed is used when none is given.
+type ApiRenderTemplateData struct {
+	Template   string `json:"template"`
+	Source     string `json:"source"`
+	Aggression int    `json:"aggression"`
+	Seed       *int64 `json:"seed"`
+}
+
+// ApiRenderTemplateReply OUTPUT: A rendered preview and how it came out. Render time is in seconds.
+type ApiRenderTemplateReply struct {
+	HTML       string             `json:"html"`
+	Seed       int64              `json:"seed"`
+	Aggression int                `json:"aggression"`
+	RenderTime float64            `json:"renderTime"`
+	Bytes      int                `json:"bytes"`
+	MacroCalls int                `json:"macroCalls"`
+	Macros     map[string]int     `json:"macros"`
+	Tiers      map[string]bool    `json:"tiers"`
+	Errors     []ApiTemplateError `json:"errors"`
+}
+
 // ApiDeleteTemplateData INPUT: Defines data the client needs to send to the server to delete an existing template.
 type ApiDeleteTemplateData struct {
 	FileName string `json:"fileName"`
 }
 
+// ApiMarkovTrainData INPUT: Text to train a Markov model on. The model is created if it doesn't exist, and is the
+// default model if none is named.
 type ApiMarkovTrainData struct {
+	Model  string `json:"model"`
 	Corpus string `json:"corpus"`
 }
+
+// ApiMarkovUploadProgress OUTPUT: One line of the progress streamed while a model is trained on uploaded files. The
+// last line has Done set, or Error if training failed and the model was left as it was.
+type ApiMarkovUploadProgress struct {
+	Model string `json:"model"`
+	CorpusStats
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// ApiMarkovModelData INPUT: Names the Markov model to act on
+type ApiMarkovModelData struct {
+	Model string `json:"model"`
+}
+
+// ApiMarkovModelInfo OUTPUT: A loaded Markov model. Size is that of its file in bytes.
+type ApiMarkovModelInfo struct {
+	Name  string `json:"name"`
+	Order int    `json:"order"`
+	Size  int64  `json:"size"`
+}
+
+// ApiMarkovListReply OUTPUT: The loaded Markov models
+type ApiMarkovListReply struct {
+	Models []ApiMarkovModelInfo `json:"models"`
+}
@@ -0,0 +1,222 @@
+package utilities
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles an AuthKey can have. RoleRead may use GET and HEAD, RoleAdmin may use everything.
+const (
+	RoleRead  = "read"
+	RoleAdmin = "admin"
+)
+
+// Headers of an HMAC-signed request
+const (
+	KeyHeader       = "X-Chunchunmaru-Key"
+	TimestampHeader = "X-Chunchunmaru-Timestamp"
+	NonceHeader     = "X-Chunchunmaru-Nonce"
+	SignatureHeader = "X-Chunchunmaru-Signature"
+)
+
+// maxSignedBody Largest request body that can be HMAC-signed, since the body has to be read to check the signature.
+// Larger uploads should use a bearer token.
+const maxSignedBody = 64 << 20
+
+// Limits on the nonces of signed requests. maxNonces bounds how many are remembered at once; while that many are still
+// within auth_max_skew, further signed requests are refused.
+const (
+	maxNonceLength = 128
+	maxNonces      = 100000
+)
+
+// nonceCache Remembers the nonces of signed requests until their timestamps fall outside the allowed skew, so a signed
+// request can only be used once
+type nonceCache struct {
+	mu sync.Mutex
+	// seen When each key's nonces can be forgotten, by key name and nonce
+	seen map[string]time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// use Records nonce for the key name until expires. Fails if the nonce was already used, or if the cache is full of
+// nonces that haven't expired yet.
+func (c *nonceCache) use(name, nonce string, expires time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := name + "\n" + nonce
+	now := time.Now()
+	if expiry, ok := c.seen[id]; ok && now.Before(expiry) {
+		return fmt.Errorf("nonce was already used")
+	}
+	if len(c.seen) >= maxNonces {
+		for seen, expiry := range c.seen {
+			if !now.Before(expiry) {
+				delete(c.seen, seen)
+			}
+		}
+		if len(c.seen) >= maxNonces {
+			return fmt.Errorf("too many signed requests, try again later")
+		}
+	}
+	c.seen[id] = expires
+	return nil
+}
+
+// AuthKey A credential for /config and /api. The secret is sent as a bearer token or used to sign requests.
+type AuthKey struct {
+	Secret string `json:"secret"`
+	Role   string `json:"role"`
+}
+
+// roleKey Context key of the role a request was authorized with
+type roleKey struct{}
+
+// RoleFromContext Returns the role a request was authorized with by RequireAuth, or an empty string
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey{}).(string)
+	return role
+}
+
+// requiredRole Returns the role needed to make a request with method
+func requiredRole(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return RoleRead
+	}
+	return RoleAdmin
+}
+
+// RequireAuth Wraps the admin endpoints so only requests with a valid bearer token or HMAC signature from one of the
+// configured AuthKeys get through, and only with a role allowed to use the request's method. With no keys configured,
+// only unproxied requests from the loopback interface are let through, as admin.
+//
+// Signed requests carry the key's name in X-Chunchunmaru-Key, the Unix time in X-Chunchunmaru-Timestamp, a value
+// unique to the request in X-Chunchunmaru-Nonce and, in X-Chunchunmaru-Signature, the hex HMAC-SHA256 with the key's
+// secret of SigningString. Each nonce is accepted once while its timestamp is within AuthMaxSkew, so a signed request
+// can't be replayed.
+func RequireAuth(cm *ConfigManager, next http.Handler) http.Handler {
+	nonces := newNonceCache()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := cm.GetConfig()
+		name, role, err := authenticate(config, nonces, r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chunchunmaru"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if required := requiredRole(r.Method); role != RoleAdmin && role != required {
+			log.Printf("Denied %s %s to %s with role %s\n", r.Method, r.URL.Path, name, role)
+			http.Error(w, "This key may not "+r.Method+" "+r.URL.Path+".", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), roleKey{}, role)))
+	})
+}
+
+// authenticate Returns the name and role of the key a request was made with. Nonces of signed requests are checked
+// against nonces.
+func authenticate(config Config, nonces *nonceCache, r *http.Request) (string, string, error) {
+	if len(config.AuthKeys) == 0 {
+		// A reverse proxy on the same machine connects from loopback too, so forwarded requests don't count
+		forwarded := r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" || r.Header.Get("X-Real-Ip") != ""
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if addr, parseErr := netip.ParseAddr(host); err == nil && parseErr == nil && addr.IsLoopback() && !forwarded {
+			return "loopback", RoleAdmin, nil
+		}
+		return "", "", fmt.Errorf("no auth keys are configured, so the API is only available from localhost")
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for name, key := range config.AuthKeys {
+			if hmac.Equal([]byte(token), []byte(key.Secret)) {
+				return name, key.Role, nil
+			}
+		}
+		return "", "", fmt.Errorf("invalid bearer token")
+	}
+
+	name := r.Header.Get(KeyHeader)
+	if name == "" {
+		return "", "", fmt.Errorf("missing bearer token or %s header", KeyHeader)
+	}
+	key, ok := config.AuthKeys[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown key %q", name)
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid %s header", TimestampHeader)
+	}
+	if skew := time.Since(time.Unix(timestamp, 0)).Abs(); skew > time.Duration(config.AuthMaxSkew) {
+		return "", "", fmt.Errorf("request timestamp is %s off", skew.Round(time.Second))
+	}
+	nonce := r.Header.Get(NonceHeader)
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return "", "", fmt.Errorf("missing or invalid %s header", NonceHeader)
+	}
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid %s header", SignatureHeader)
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxSignedBody))
+	if err != nil {
+		return "", "", fmt.Errorf("reading body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if !hmac.Equal(signature, Sign(key.Secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)) {
+		return "", "", fmt.Errorf("invalid signature")
+	}
+	// Only nonces of correctly signed requests are remembered, so others can't fill the cache
+	if err := nonces.use(name, nonce, time.Unix(timestamp, 0).Add(time.Duration(config.AuthMaxSkew))); err != nil {
+		return "", "", err
+	}
+	return name, key.Role, nil
+}
+
+// SigningString Returns what is signed for a request: the method, path and query, timestamp, nonce and hex SHA-256 of
+// the body, one per line.
+func SigningString(method, requestURI string, timestamp int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return method + "\n" + requestURI + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])
+}
+
+// Sign Returns the HMAC-SHA256 signature of a request
+func Sign(secret, method, requestURI string, timestamp int64, nonce string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(SigningString(method, requestURI, timestamp, nonce, body)))
+	return mac.Sum(nil)
+}
+
+// Redacted Returns config with its secrets blanked, for callers that may read but not change it
+func (c Config) Redacted() Config {
+	if c.Secret != "" {
+		c.Secret = "REDACTED"
+	}
+	if c.AuthKeys == nil {
+		return c
+	}
+	keys := make(map[string]AuthKey, len(c.AuthKeys))
+	for name, key := range c.AuthKeys {
+		key.Secret = "REDACTED"
+		keys[name] = key
+	}
+	c.AuthKeys = keys
+	return c
+}
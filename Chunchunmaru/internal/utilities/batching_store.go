@@ -0,0 +1,389 @@
+package utilities
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// cachedRecord A client record held by a BatchingStore
+type cachedRecord struct {
+	record ClientRecord
+	// dirty The record has changed since it was last flushed
+	dirty bool
+	// touched The record was read or changed since the previous flush
+	touched bool
+}
+
+// flushedRecord A cached record in a batch being written, and where it is cached
+type flushedRecord struct {
+	kind  ClientKind
+	key   string
+	entry *cachedRecord
+}
+
+// StoreStats Counters describing a BatchingStore's queue.
+type StoreStats struct {
+	// QueueDepth Changed client records and request log entries waiting for the next flush
+	QueueDepth int `json:"queueDepth"`
+	// Dropped Hits and log entries discarded because the queue was full
+	Dropped uint64 `json:"dropped"`
+	// Cached Client records held in memory
+	Cached int `json:"cached"`
+	// Flushes Batches written to the backing store
+	Flushes uint64 `json:"flushes"`
+	// FlushErrors Batches the backing store failed to write
+	FlushErrors uint64 `json:"flushErrors"`
+}
+
+// defaultFlushInterval How often a BatchingStore given no usable interval flushes
+const defaultFlushInterval = time.Second
+
+// BatchingStore A ClientStore that applies hits to cached records right away and writes them to a backing store in
+// periodic batches, keeping the database off the request path. At most queueSize changed records and log entries wait
+// for a flush. Once the queue is full, hits on clients without a pending change are scored but not stored, and log
+// entries are dropped.
+type BatchingStore struct {
+	backend   BatchStore
+	queueSize int
+	cacheSize int
+
+	mu    sync.Mutex
+	cache map[ClientKind]map[string]*cachedRecord
+	// resets Counts the starts and ends of resets and prunes of each kind, so a record loaded from the backend while
+	// one was under way isn't cached
+	resets   map[ClientKind]uint64
+	dirty    int
+	requests []RequestEntry
+	stats    StoreStats
+
+	// flushMu Keeps flushes from overlapping, so batches reach the backend in order, and resets out of the way of
+	// batches being written
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	closed  sync.Once
+}
+
+// NewBatchingStore Returns a store that flushes to backend every interval, or every second if interval isn't positive.
+// cacheSize bounds how many unchanged records are kept in memory between flushes.
+func NewBatchingStore(backend BatchStore, interval time.Duration, queueSize, cacheSize int) *BatchingStore {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	s := &BatchingStore{
+		backend:   backend,
+		queueSize: queueSize,
+		cacheSize: cacheSize,
+		cache:     make(map[ClientKind]map[string]*cachedRecord, len(ClientKinds)),
+		resets:    make(map[ClientKind]uint64, len(ClientKinds)),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, kind := range ClientKinds {
+		s.cache[kind] = make(map[string]*cachedRecord)
+	}
+	go s.run(interval)
+	return s
+}
+
+// run Flushes every interval until the store is closed
+func (s *BatchingStore) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Println("Error flushing client store ", err)
+			}
+		}
+	}
+}
+
+// queueFull Reports whether another change would exceed the queue. Must be called with mu held.
+func (s *BatchingStore) queueFull() bool {
+	return s.queueSize > 0 && s.dirty+len(s.requests) >= s.queueSize
+}
+
+// cached Returns the cached record for a client, loading it from the backend on a miss.
+func (s *BatchingStore) cached(kind ClientKind, key string) (*cachedRecord, error) {
+	for {
+		s.mu.Lock()
+		clients, ok := s.cache[kind]
+		if !ok {
+			s.mu.Unlock()
+			return nil, errUnknownKind(kind)
+		}
+		if entry, ok := clients[key]; ok {
+			entry.touched = true
+			s.mu.Unlock()
+			return entry, nil
+		}
+		resets := s.resets[kind]
+		s.mu.Unlock()
+
+		// Load without holding the lock, so a slow read doesn't stall hits on cached clients
+		record, _, err := s.backend.Reputation(kind, key)
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		if s.resets[kind] != resets {
+			// The record may be from before a reset, so load it again
+			s.mu.Unlock()
+			continue
+		}
+		// Another hit may have loaded the client in the meantime, in which case its copy wins
+		entry, ok := clients[key]
+		if !ok {
+			entry = &cachedRecord{record: record}
+			clients[key] = entry
+		}
+		entry.touched = true
+		s.mu.Unlock()
+		return entry, nil
+	}
+}
+
+// markReset Counts the start or end of a reset or prune of kinds, for cached to notice. Must be called with mu held,
+// once before the backend forgets clients and once after.
+func (s *BatchingStore) markReset(kinds ...ClientKind) {
+	for _, kind := range kinds {
+		s.resets[kind]++
+	}
+}
+
+func (s *BatchingStore) RecordHit(kind ClientKind, key string, update func(*ClientRecord)) (ClientRecord, error) {
+	for {
+		entry, err := s.cached(kind, key)
+		if err != nil {
+			return ClientRecord{}, err
+		}
+
+		s.mu.Lock()
+		if s.cache[kind][key] != entry {
+			// Evicted or reset while loading, so start over
+			s.mu.Unlock()
+			continue
+		}
+		if !entry.dirty && s.queueFull() {
+			// Score the hit, but leave the record as it was
+			s.stats.Dropped++
+			record := entry.record
+			s.mu.Unlock()
+			update(&record)
+			return record, nil
+		}
+		update(&entry.record)
+		if !entry.dirty {
+			entry.dirty = true
+			s.dirty++
+		}
+		record := entry.record
+		s.mu.Unlock()
+		return record, nil
+	}
+}
+
+func (s *BatchingStore) Reputation(kind ClientKind, key string) (ClientRecord, bool, error) {
+	s.mu.Lock()
+	if entry, ok := s.cache[kind][key]; ok {
+		record := entry.record
+		s.mu.Unlock()
+		return record, record.Queries > 0, nil
+	}
+	s.mu.Unlock()
+	return s.backend.Reputation(kind, key)
+}
+
+func (s *BatchingStore) List(kind ClientKind) ([]ClientRecord, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.backend.List(kind)
+}
+
+func (s *BatchingStore) Reset(kind ClientKind, key string) error {
+	// Wait for a batch being written, which could otherwise write the client back after the backend forgot it
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.mu.Lock()
+	clients, ok := s.cache[kind]
+	if !ok {
+		s.mu.Unlock()
+		return errUnknownKind(kind)
+	}
+	s.markReset(kind)
+	for cachedKey, entry := range clients {
+		if key == "" || cachedKey == key {
+			if entry.dirty {
+				s.dirty--
+			}
+			delete(clients, cachedKey)
+		}
+	}
+	s.mu.Unlock()
+	err := s.backend.Reset(kind, key)
+	s.mu.Lock()
+	s.markReset(kind)
+	s.mu.Unlock()
+	return err
+}
+
+func (s *BatchingStore) Prune(cutoff time.Time) (int, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	s.markReset(ClientKinds...)
+	for _, clients := range s.cache {
+		for key, entry := range clients {
+			if entry.record.LastSeen.Before(cutoff) && !entry.dirty {
+				delete(clients, key)
+			}
+		}
+	}
+	s.mu.Unlock()
+	removed, err := s.backend.Prune(cutoff)
+	s.mu.Lock()
+	s.markReset(ClientKinds...)
+	s.mu.Unlock()
+	return removed, err
+}
+
+func (s *BatchingStore) LogRequest(entry RequestEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queueFull() {
+		s.stats.Dropped++
+		return nil
+	}
+	s.requests = append(s.requests, entry)
+	return nil
+}
+
+func (s *BatchingStore) Requests(filter RequestFilter) ([]RequestEntry, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.backend.Requests(filter)
+}
+
+func (s *BatchingStore) PruneRequests(cutoff time.Time, maxRows int) (int, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	return s.backend.PruneRequests(cutoff, maxRows)
+}
+
+// Stats Returns the store's queue counters
+func (s *BatchingStore) Stats() StoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.QueueDepth = s.dirty + len(s.requests)
+	for _, clients := range s.cache {
+		stats.Cached += len(clients)
+	}
+	return stats
+}
+
+// Flush Writes every pending change to the backing store in one batch. Changes that fail to write stay queued.
+func (s *BatchingStore) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := Batch{Clients: make(map[ClientKind][]ClientRecord), Requests: s.requests}
+	var flushed []flushedRecord
+	for kind, clients := range s.cache {
+		for key, entry := range clients {
+			if entry.dirty {
+				batch.Clients[kind] = append(batch.Clients[kind], entry.record)
+				flushed = append(flushed, flushedRecord{kind: kind, key: key, entry: entry})
+				entry.dirty = false
+			}
+		}
+	}
+	s.dirty -= len(flushed)
+	s.requests = nil
+	s.mu.Unlock()
+
+	if len(flushed) == 0 && len(batch.Requests) == 0 {
+		s.evict()
+		return nil
+	}
+	err := s.backend.WriteBatch(batch)
+
+	s.mu.Lock()
+	if err != nil {
+		s.stats.FlushErrors++
+		// Requeue, unless the record changed again and was requeued by the hit, or was dropped from the cache by a
+		// prune and so would never be flushed again
+		for _, flushed := range flushed {
+			if !flushed.entry.dirty && s.cache[flushed.kind][flushed.key] == flushed.entry {
+				flushed.entry.dirty = true
+				s.dirty++
+			}
+		}
+		s.requests = append(batch.Requests, s.requests...)
+	} else {
+		s.stats.Flushes++
+	}
+	s.mu.Unlock()
+	s.evict()
+	return err
+}
+
+// evict Drops cached records that are clean and were not used since the previous flush, and any clean records beyond
+// cacheSize.
+func (s *BatchingStore) evict() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached := 0
+	for _, clients := range s.cache {
+		for key, entry := range clients {
+			if !entry.dirty && !entry.touched {
+				delete(clients, key)
+				continue
+			}
+			entry.touched = false
+			cached++
+		}
+	}
+	if s.cacheSize <= 0 || cached <= s.cacheSize {
+		return
+	}
+	for _, clients := range s.cache {
+		for key, entry := range clients {
+			if cached <= s.cacheSize {
+				return
+			}
+			if !entry.dirty {
+				delete(clients, key)
+				cached--
+			}
+		}
+	}
+}
+
+// Close Stops the flush loop, writes anything still pending and closes the backing store.
+func (s *BatchingStore) Close() error {
+	var err error
+	s.closed.Do(func() {
+		close(s.stop)
+		<-s.done
+		if err = s.Flush(); err != nil {
+			log.Println("Error flushing client store on close ", err)
+		}
+		if closeErr := s.backend.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
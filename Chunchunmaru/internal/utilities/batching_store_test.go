@@ -0,0 +1,170 @@
+package utilities
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchingStoreFlushes(t *testing.T) {
+	backend := NewMemoryStore()
+	// A long interval, so only explicit flushes reach the backend
+	store := NewBatchingStore(backend, time.Hour, 100, 100)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		record, err := store.RecordHit(ClientIP, "203.0.113.7", func(record *ClientRecord) {
+			record.Record(Hit{Time: now}, time.Hour)
+		})
+		if err != nil || record.Queries != i+1 {
+			t.Fatalf("hit %d: expected %d queries, got %d, %v", i, i+1, record.Queries, err)
+		}
+	}
+	store.LogRequest(RequestEntry{Time: now, Path: "/"})
+
+	if _, ok, _ := backend.Reputation(ClientIP, "203.0.113.7"); ok {
+		t.Fatal("hits reached the backend before a flush")
+	}
+	if stats := store.Stats(); stats.QueueDepth != 2 {
+		t.Fatalf("expected a queue depth of 2, got %+v", stats)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	record, ok, _ := backend.Reputation(ClientIP, "203.0.113.7")
+	if !ok || record.Queries != 5 {
+		t.Fatalf("expected 5 queries after closing, got %+v", record)
+	}
+	if entries, _ := backend.Requests(RequestFilter{}); len(entries) != 1 {
+		t.Fatalf("expected the request log entry to be flushed, got %d", len(entries))
+	}
+}
+
+func TestBatchingStoreDropsWhenFull(t *testing.T) {
+	store := NewBatchingStore(NewMemoryStore(), time.Hour, 2, 100)
+	defer store.Close()
+	hit := func(record *ClientRecord) { record.Queries++ }
+
+	store.RecordHit(ClientIP, "a", hit)
+	store.RecordHit(ClientIP, "b", hit)
+	// Already queued clients keep counting, new ones are scored but dropped
+	if record, _ := store.RecordHit(ClientIP, "a", hit); record.Queries != 2 {
+		t.Fatalf("expected queued client to keep counting, got %d", record.Queries)
+	}
+	if record, _ := store.RecordHit(ClientIP, "c", hit); record.Queries != 1 {
+		t.Fatalf("expected dropped hit to still be scored, got %d", record.Queries)
+	}
+	store.LogRequest(RequestEntry{})
+	if stats := store.Stats(); stats.Dropped != 2 || stats.QueueDepth != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if record, _, _ := store.Reputation(ClientIP, "c"); record.Queries != 0 {
+		t.Fatalf("dropped hit was stored: %+v", record)
+	}
+}
+
+// blockingBackend A backend whose batches wait for release and then fail
+type blockingBackend struct {
+	*MemoryStore
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBackend) WriteBatch(batch Batch) error {
+	b.writing <- struct{}{}
+	<-b.release
+	b.MemoryStore.WriteBatch(batch)
+	return errors.New("disk full")
+}
+
+func TestBatchingStoreResetDuringFlush(t *testing.T) {
+	backend := &blockingBackend{MemoryStore: NewMemoryStore(), writing: make(chan struct{}), release: make(chan struct{})}
+	store := NewBatchingStore(backend, time.Hour, 2, 100)
+	store.RecordHit(ClientIP, "a", func(record *ClientRecord) { record.Queries++ })
+	flushed := make(chan error)
+	go func() { flushed <- store.Flush() }()
+	<-backend.writing
+
+	reset := make(chan error)
+	go func() { reset <- store.Reset(ClientIP, "") }()
+	select {
+	case <-reset:
+		t.Fatal("reset didn't wait for the batch being written")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(backend.release)
+	if err := <-flushed; err == nil {
+		t.Fatal("expected the flush to fail")
+	}
+	if err := <-reset; err != nil {
+		t.Fatal(err)
+	}
+
+	if record, ok, _ := store.Reputation(ClientIP, "a"); ok {
+		t.Fatalf("expected the reset to stick, got %+v", record)
+	}
+	if stats := store.Stats(); stats.QueueDepth != 0 {
+		t.Fatalf("expected nothing queued for reset clients, got %+v", stats)
+	}
+	// The queue has room again for new clients
+	store.RecordHit(ClientIP, "b", func(record *ClientRecord) { record.Queries++ })
+	store.RecordHit(ClientIP, "c", func(record *ClientRecord) { record.Queries++ })
+	if stats := store.Stats(); stats.Dropped != 0 || stats.QueueDepth != 2 {
+		t.Fatalf("expected both hits to be queued, got %+v", stats)
+	}
+}
+
+// slowLoadBackend A backend whose first load waits for release after reading the record
+type slowLoadBackend struct {
+	*MemoryStore
+	loading chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *slowLoadBackend) Reputation(kind ClientKind, key string) (ClientRecord, bool, error) {
+	record, ok, err := b.MemoryStore.Reputation(kind, key)
+	b.once.Do(func() {
+		close(b.loading)
+		<-b.release
+	})
+	return record, ok, err
+}
+
+func TestBatchingStoreResetDuringLoad(t *testing.T) {
+	backend := &slowLoadBackend{MemoryStore: NewMemoryStore(), loading: make(chan struct{}), release: make(chan struct{})}
+	backend.RecordHit(ClientIP, "a", func(record *ClientRecord) { record.Queries = 5 })
+	store := NewBatchingStore(backend, time.Hour, 100, 100)
+
+	hit := make(chan ClientRecord)
+	go func() {
+		record, _ := store.RecordHit(ClientIP, "a", func(record *ClientRecord) { record.Queries++ })
+		hit <- record
+	}()
+	<-backend.loading
+	if err := store.Reset(ClientIP, "a"); err != nil {
+		t.Fatal(err)
+	}
+	close(backend.release)
+	if record := <-hit; record.Queries != 1 {
+		t.Fatalf("expected the hit to start from the reset record, got %+v", record)
+	}
+}
+
+func TestBatchingStoreDefaultInterval(t *testing.T) {
+	store := NewBatchingStore(NewMemoryStore(), 0, 100, 100)
+	defer store.Close()
+	store.RecordHit(ClientIP, "a", func(record *ClientRecord) { record.Queries++ })
+	deadline := time.Now().Add(5 * defaultFlushInterval)
+	for store.Stats().Flushes == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a store without an interval to flush on the default one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,113 @@
+package utilities
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Markers padding words in a CharModel, standing for the start and the end of a word
+const (
+	charStart = '\x02'
+	charEnd   = '\x03'
+)
+
+// charModelAttempts How many words Generate makes before settling for one that is too long or is a seed word
+const charModelAttempts = 20
+
+// charChoices The characters that can follow a context, with their cumulative counts for sampling
+type charChoices struct {
+	runes      []rune
+	cumulative []int
+}
+
+// CharModel A character-level Markov chain, for making up words that look like the ones it was trained on. Unlike the
+// word models it can be shared between goroutines freely, as it is never changed after it is built.
+type CharModel struct {
+	order   int
+	choices map[string]charChoices
+	// seeds The training words, lowercased, so Generate can avoid repeating them
+	seeds                map[string]bool
+	minLength, maxLength int
+}
+
+// NewCharModel Builds a model that looks back order characters from words
+func NewCharModel(order int, words []string) *CharModel {
+	model := &CharModel{order: order, choices: make(map[string]charChoices), seeds: make(map[string]bool)}
+	counts := make(map[string]map[rune]int)
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		length := utf8.RuneCountInString(word)
+		if model.minLength == 0 || length < model.minLength {
+			model.minLength = length
+		}
+		model.maxLength = max(model.maxLength, length)
+		model.seeds[strings.ToLower(word)] = true
+
+		runes := []rune(strings.Repeat(string(charStart), order) + word + string(charEnd))
+		for i := order; i < len(runes); i++ {
+			context := string(runes[i-order : i])
+			if counts[context] == nil {
+				counts[context] = make(map[rune]int)
+			}
+			counts[context][runes[i]]++
+		}
+	}
+
+	// Choices are kept in a fixed order so the same random source always makes the same words
+	for context, next := range counts {
+		var choices charChoices
+		for r := range next {
+			choices.runes = append(choices.runes, r)
+		}
+		sort.Slice(choices.runes, func(i, j int) bool { return choices.runes[i] < choices.runes[j] })
+		total := 0
+		for _, r := range choices.runes {
+			total += next[r]
+			choices.cumulative = append(choices.cumulative, total)
+		}
+		model.choices[context] = choices
+	}
+	return model
+}
+
+// next Picks the character following context
+func (m *CharModel) next(r *rand.Rand, context []rune) rune {
+	choices, ok := m.choices[string(context)]
+	if !ok {
+		return charEnd
+	}
+	n := r.Intn(choices.cumulative[len(choices.cumulative)-1])
+	return choices.runes[sort.SearchInts(choices.cumulative, n+1)]
+}
+
+// Generate Makes up a word no longer than maxLength characters, or than the longest training word if maxLength isn't
+// positive, that isn't one of the training words. If no such word turns up after a few tries, the last one is cut
+// to length.
+func (m *CharModel) Generate(r *rand.Rand, maxLength int) string {
+	limit := m.maxLength
+	if maxLength > 0 {
+		limit = min(limit, maxLength)
+	}
+	var word []rune
+	for attempt := 0; attempt < charModelAttempts; attempt++ {
+		context := []rune(strings.Repeat(string(charStart), m.order))
+		word = word[:0]
+		for len(word) <= limit {
+			next := m.next(r, context[len(context)-m.order:])
+			if next == charEnd {
+				break
+			}
+			word = append(word, next)
+			context = append(context, next)
+		}
+		if len(word) >= min(m.minLength, limit) && len(word) <= limit && !m.seeds[strings.ToLower(string(word))] {
+			return string(word)
+		}
+	}
+	return string(word[:min(len(word), limit)])
+}
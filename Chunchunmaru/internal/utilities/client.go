@@ -0,0 +1,59 @@
+package utilities
+
+import (
+	"math"
+	"time"
+)
+
+// intervalSmoothing Weight of the newest interval in the moving average of time between requests
+const intervalSmoothing = 0.2
+
+// ClientRecord Everything remembered about one client key, such as an IP or a user agent.
+type ClientRecord struct {
+	Key          string
+	Queries      int
+	Aggression   int
+	Rate         float64
+	LastSeen     time.Time
+	IntervalMean float64
+	IntervalVar  float64
+	CookieMisses int
+	HoneypotHits int
+}
+
+// Hit A single request counted against a client
+type Hit struct {
+	Time      time.Time
+	HasCookie bool
+	Honeypot  bool
+}
+
+// Record Folds hit into the record, decaying the request rate with halfLife.
+func (c *ClientRecord) Record(hit Hit, halfLife time.Duration) {
+	if !c.LastSeen.IsZero() {
+		interval := math.Max(hit.Time.Sub(c.LastSeen).Seconds(), 0)
+		if c.IntervalMean == 0 && c.IntervalVar == 0 {
+			c.IntervalMean = interval
+		} else {
+			// Exponentially weighted mean and variance of the time between requests
+			diff := interval - c.IntervalMean
+			increment := intervalSmoothing * diff
+			c.IntervalMean += increment
+			c.IntervalVar = (1 - intervalSmoothing) * (c.IntervalVar + diff*increment)
+		}
+	}
+	c.Rate = DecayRate(c.Rate, c.LastSeen, hit.Time, halfLife) + 1
+	if c.Queries > 0 && !hit.HasCookie {
+		c.CookieMisses++
+	}
+	if hit.Honeypot {
+		c.HoneypotHits++
+	}
+	c.Queries++
+	c.LastSeen = hit.Time
+}
+
+// RateAt Returns what the record's request rate has decayed to by now.
+func (c *ClientRecord) RateAt(now time.Time, halfLife time.Duration) float64 {
+	return DecayRate(c.Rate, c.LastSeen, now, halfLife)
+}
@@ -1,8 +1,10 @@
 package utilities
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"sync"
@@ -35,24 +37,61 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 }
 
 // MarshalJSON Marshal the json
-func (d *Duration) MarshalJSON() ([]byte, error) {
-	return json.Marshal(time.Duration(*d).String())
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
 }
 
 type Config struct {
-	Port                 int      `json:"port"`
-	MinDelay             Duration `json:"minDelay"`
-	MaxDelay             Duration `json:"maxDelay"`
-	HostName             string   `json:"hostname"`
-	PathWhitelist        []string `json:"path_whitelist"`
-	MinSubpaths          int      `json:"min_subpaths"`
-	MaxSubpaths          int      `json:"max_subpaths"`
-	QueriesPerAggression int      `json:"queries_per_aggression"`
+	Port                   int                `json:"port"`
+	MinDelay               Duration           `json:"minDelay"`
+	MaxDelay               Duration           `json:"maxDelay"`
+	HostName               string             `json:"hostname"`
+	PathWhitelist          []string           `json:"path_whitelist"`
+	MinSubpaths            int                `json:"min_subpaths"`
+	MaxSubpaths            int                `json:"max_subpaths"`
+	QueriesPerAggression   int                `json:"queries_per_aggression"`
+	ChunkSize              int                `json:"chunk_size"`
+	MinChunkDelay          Duration           `json:"min_chunk_delay"`
+	MaxChunkDelay          Duration           `json:"max_chunk_delay"`
+	MaxStreamTime          Duration           `json:"max_stream_time"`
+	Secret                 string             `json:"secret"`
+	SeedWithQuery          bool               `json:"seed_with_query"`
+	TrapPaths              []string           `json:"trap_paths"`
+	SuspectAggression      int                `json:"suspect_aggression"`
+	AggressionHalfLife     Duration           `json:"aggression_half_life"`
+	ScoreWeights           map[string]float64 `json:"score_weights"`
+	CookieName             string             `json:"cookie_name"`
+	TrustedProxies         []string           `json:"trusted_proxies"`
+	IPv6Prefix             int                `json:"ipv6_prefix"`
+	SubnetPrefixV4         int                `json:"subnet_prefix_v4"`
+	SubnetPrefixV6         int                `json:"subnet_prefix_v6"`
+	ASNDatabase            string             `json:"asn_database"`
+	AggregationMode        string             `json:"aggregation_mode"`
+	AggregationWeights     map[string]float64 `json:"aggregation_weights"`
+	DatabasePath           string             `json:"database_path"`
+	RequestLogRetention    Duration           `json:"request_log_retention"`
+	RequestLogMaxRows      int                `json:"request_log_max_rows"`
+	RetentionInterval      Duration           `json:"retention_interval"`
+	ClientRetention        Duration           `json:"client_retention"`
+	FlushInterval          Duration           `json:"flush_interval"`
+	HitQueueSize           int                `json:"hit_queue_size"`
+	CacheSize              int                `json:"cache_size"`
+	PersistConfig          bool               `json:"persist_config"`
+	BindAddress            string             `json:"bind_address"`
+	ShutdownTimeout        Duration           `json:"shutdown_timeout"`
+	AuthKeys               map[string]AuthKey `json:"auth_keys"`
+	AuthMaxSkew            Duration           `json:"auth_max_skew"`
+	AdminAddress           string             `json:"admin_address"`
+	TemplateReloadInterval Duration           `json:"template_reload_interval"`
+	EmailDomains           map[string]float64 `json:"email_domains"`
+	CorpusMaxFileSize      int                `json:"corpus_max_file_size"`
 }
 
 type ConfigManager struct {
-	config Config
-	mu     sync.RWMutex
+	config    Config
+	path      string
+	listeners []func(old, new Config)
+	mu        sync.RWMutex
 }
 
 // NewConfigManager Returns a new config manager
@@ -62,16 +101,93 @@ func NewConfigManager(initialConfig Config) *ConfigManager {
 	}
 }
 
-var AppConfig = NewConfigManager(Config{
-	Port:                 8080,
-	MinDelay:             Duration(1000 * time.Millisecond),
-	MaxDelay:             Duration(5000 * time.Millisecond),
-	HostName:             "http://localhost:8080",
-	PathWhitelist:        []string{},
-	MinSubpaths:          1,
-	MaxSubpaths:          5,
-	QueriesPerAggression: 50,
-})
+// DefaultConfig Returns the configuration Chunchunmaru starts with
+func DefaultConfig() Config {
+	return Config{
+		Port:                 8080,
+		MinDelay:             Duration(1000 * time.Millisecond),
+		MaxDelay:             Duration(5000 * time.Millisecond),
+		HostName:             "http://localhost:8080",
+		PathWhitelist:        []string{},
+		MinSubpaths:          1,
+		MaxSubpaths:          5,
+		QueriesPerAggression: 50,
+		ChunkSize:            256,
+		MinChunkDelay:        Duration(50 * time.Millisecond),
+		MaxChunkDelay:        Duration(250 * time.Millisecond),
+		MaxStreamTime:        Duration(60 * time.Second),
+		Secret:               "",
+		SeedWithQuery:        true,
+		TrapPaths:            []string{},
+		SuspectAggression:    10,
+		AggressionHalfLife:   Duration(time.Hour),
+		// headers is kept low enough that a browser missing both headers stays under SuspectAggression on its own
+		ScoreWeights: map[string]float64{
+			"rate":       1.0,
+			"user_agent": 0.25,
+			"headers":    0.05,
+			"cookies":    0.2,
+			"timing":     0.3,
+			"honeypot":   1.0,
+		},
+		CookieName:     "sid",
+		TrustedProxies: []string{},
+		IPv6Prefix:     64,
+		SubnetPrefixV4: 24,
+		SubnetPrefixV6: 48,
+		ASNDatabase:    "",
+		// "max" takes the highest weighted score, "weighted" the weighted average
+		AggregationMode: "max",
+		AggregationWeights: map[string]float64{
+			"ip":     1.0,
+			"subnet": 0.5,
+			"asn":    0.25,
+		},
+		// Empty keeps clients in memory only
+		DatabasePath: "./chunchunmaru.db",
+		// Zero keeps the request log forever or at any size
+		RequestLogRetention: Duration(7 * 24 * time.Hour),
+		RequestLogMaxRows:   1000000,
+		RetentionInterval:   Duration(10 * time.Minute),
+		// How long a client is remembered after its last request, zero for forever
+		ClientRetention: Duration(30 * 24 * time.Hour),
+		// Zero writes every hit to the database as it happens
+		FlushInterval: Duration(time.Second),
+		HitQueueSize:  10000,
+		CacheSize:     100000,
+		// Write changes made through the API back to the config file
+		PersistConfig: false,
+		// Empty listens on every interface
+		BindAddress: "",
+		// How long connections get to finish on shutdown or when the server moves to a new address
+		ShutdownTimeout: Duration(30 * time.Second),
+		// Named credentials for /config and /api. Without any, those endpoints only answer requests from localhost.
+		AuthKeys: map[string]AuthKey{},
+		// How far the timestamp of a signed request may be from the server's clock
+		AuthMaxSkew: Duration(5 * time.Minute),
+		// Empty serves /config and /api alongside the tarpit. A host:port such as 127.0.0.1:8081 serves them there
+		// instead, and nowhere else.
+		AdminAddress: "",
+		// How often the templates directory is checked for changes. Zero only picks up changes made through the API.
+		TemplateReloadInterval: Duration(2 * time.Second),
+		// Relative odds of each domain in generated email addresses. "*" stands for a made up domain.
+		EmailDomains: map[string]float64{
+			"gmail.com":   30,
+			"yahoo.com":   10,
+			"outlook.com": 10,
+			"hotmail.com": 7,
+			"icloud.com":  6,
+			"proton.me":   3,
+			"aol.com":     2,
+			"gmx.com":     2,
+			"*":           30,
+		},
+		// The most bytes of a corpus HTML document or zip archive held in memory or on disk while training
+		CorpusMaxFileSize: 64 * 1024 * 1024,
+	}
+}
+
+var AppConfig = NewConfigManager(DefaultConfig())
 
 // GetConfig Gets the config
 func (cm *ConfigManager) GetConfig() Config {
@@ -80,46 +196,159 @@ func (cm *ConfigManager) GetConfig() Config {
 	return cm.config
 }
 
-// SetConfig Sets the config
-func (cm *ConfigManager) SetConfig(config Config) {
+// SetPath Sets the file changes are written back to when PersistConfig is enabled
+func (cm *ConfigManager) SetPath(path string) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
-	cm.config = config
-	log.Printf("Configuration updated to: %+v\n", config)
+	cm.path = path
 }
 
-// ConfigSetAPI Handler to set the config via the API
-func (cm *ConfigManager) ConfigSetAPI(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST requests
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is supported.", http.StatusMethodNotAllowed)
-		return
+// Path Returns the file changes are written back to
+func (cm *ConfigManager) Path() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.path
+}
+
+// SetConfig Sets the config and tells every listener registered with OnChange
+func (cm *ConfigManager) SetConfig(config Config) {
+	cm.mu.Lock()
+	old := cm.config
+	cm.config = config
+	listeners := cm.listeners
+	cm.mu.Unlock()
+	log.Printf("Configuration updated to: %+v\n", config.Redacted())
+	for _, listener := range listeners {
+		listener(old, config)
 	}
+}
 
-	// Decode JSON config
-	var newConfig Config
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
+// OnChange Registers fn to be called with the previous and new config each time the config is set
+func (cm *ConfigManager) OnChange(fn func(old, new Config)) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.listeners = append(cm.listeners, fn)
+}
 
-	err := decoder.Decode(&newConfig)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// ConfigAPI Handler for /config. GET returns the live config, POST replaces it and PATCH applies a JSON merge patch
+// (RFC 7386) to it. Configs that fail Validate are rejected with the list of field errors. A config without a secret
+// keeps the current one. Secrets are only shown to admins.
+func (cm *ConfigManager) ConfigAPI(w http.ResponseWriter, r *http.Request) {
+	var newConfig Config
+	switch r.Method {
+	case http.MethodGet:
+		config := cm.GetConfig()
+		if RoleFromContext(r.Context()) != RoleAdmin {
+			config = config.Redacted()
+		}
+		writeConfigJSON(w, http.StatusOK, config)
+		return
+	case http.MethodPost:
+		// Decode JSON config
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&newConfig); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodPatch:
+		var err error
+		if newConfig, err = patchConfig(cm.GetConfig(), r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, PATCH")
+		http.Error(w, "Only GET, POST and PATCH methods are supported.", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Ensure valid config
-	if newConfig.Port < 0 || newConfig.Port > 65535 {
-		http.Error(w, "Port must be between 0 and 65535.", http.StatusBadRequest)
-		return
+	if newConfig.Secret == "" {
+		// Keep the current secret, as pages seeded with an empty one would be predictable
+		newConfig.Secret = cm.GetConfig().Secret
 	}
-	if newConfig.MinDelay < 0 {
-		http.Error(w, "Delay must be greater or equal to 0.", http.StatusBadRequest)
+
+	// Ensure valid config
+	if err := newConfig.Validate(); err != nil {
+		var fieldErrors ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeConfigJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"message": "Configuration rejected.",
+			"errors":  fieldErrors,
+		})
 		return
 	}
 
 	cm.SetConfig(newConfig)
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{
+	if newConfig.PersistConfig && cm.Path() != "" {
+		if err := WriteConfigFile(cm.Path(), newConfig); err != nil {
+			log.Println("Error writing config file ", err)
+			http.Error(w, "Configuration updated, but could not be saved: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeConfigJSON(w, http.StatusOK, map[string]string{
 		"message": "Configuration updated successfully.",
 	})
 }
+
+// writeConfigJSON Writes value as a JSON response with the given status
+func writeConfigJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println("Error writing json ", err)
+	}
+}
+
+// patchConfig Applies the JSON merge patch read from patch to config. Fields the patch sets to null are reset to their
+// zero value.
+func patchConfig(config Config, patch io.Reader) (Config, error) {
+	var patchDocument interface{}
+	if err := json.NewDecoder(patch).Decode(&patchDocument); err != nil {
+		return config, err
+	}
+	current, err := json.Marshal(config)
+	if err != nil {
+		return config, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return config, err
+	}
+	merged, err := json.Marshal(mergePatch(document, patchDocument))
+	if err != nil {
+		return config, err
+	}
+
+	var patched Config
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return config, err
+	}
+	return patched, nil
+}
+
+// mergePatch Applies an RFC 7386 merge patch to target
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
@@ -0,0 +1,280 @@
+package utilities
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix Prefix of the environment variables that override config fields, as in CHUNCHUNMARU_MIN_DELAY=2s
+const EnvPrefix = "CHUNCHUNMARU_"
+
+// DefaultConfigFiles Config files looked for in the working directory when none is given
+var DefaultConfigFiles = []string{"chunchunmaru.yaml", "chunchunmaru.yml", "chunchunmaru.json"}
+
+// LoadConfig Builds the startup config. Each source overrides the one before it:
+//
+//  1. DefaultConfig
+//  2. The config file named by -config or CHUNCHUNMARU_CONFIG, or the first of DefaultConfigFiles that exists
+//  3. CHUNCHUNMARU_* environment variables from environ
+//  4. Command-line flags in args
+//
+// Returns the config and the path of the file it was read from, which is empty if there was none.
+func LoadConfig(args []string, environ []string) (Config, string, error) {
+	config := DefaultConfig()
+	env := parseEnviron(environ)
+
+	flags := flag.NewFlagSet("chunchunmaru", flag.ContinueOnError)
+	path := flags.String("config", env["CONFIG"], "path of a JSON or YAML config file")
+	fields := configFields()
+	values := make(map[string]*string, len(fields))
+	for _, field := range fields {
+		value := new(string)
+		values[field.name] = value
+		flags.StringVar(value, strings.ReplaceAll(field.name, "_", "-"), "", field.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, "", err
+	}
+
+	if *path == "" {
+		for _, candidate := range DefaultConfigFiles {
+			if FileExists(candidate) {
+				*path = candidate
+				break
+			}
+		}
+	}
+	if *path != "" {
+		if err := ReadConfigFile(*path, &config); err != nil {
+			return config, "", err
+		}
+	}
+
+	for _, field := range fields {
+		if value, ok := env[strings.ToUpper(field.name)]; ok {
+			if err := setConfigField(&config, field, value); err != nil {
+				return config, "", fmt.Errorf("%s%s: %w", EnvPrefix, strings.ToUpper(field.name), err)
+			}
+		}
+	}
+
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, field := range fields {
+			if flagErr == nil && strings.ReplaceAll(field.name, "_", "-") == f.Name {
+				if err := setConfigField(&config, field, *values[field.name]); err != nil {
+					flagErr = fmt.Errorf("-%s: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	return config, *path, flagErr
+}
+
+// ReadConfigFile Reads a JSON or YAML config file over config, leaving fields the file does not mention as they were.
+// The format is picked by extension.
+func ReadConfigFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if isYAML(path) {
+		// Go through JSON so YAML files use the same field names and duration formats
+		var document map[string]interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteConfigFile Writes config to path as JSON or YAML, picked by extension. The file is written next to path and
+// renamed into place, so readers never see it half written. It holds the secret, so only its owner may read it: the
+// file gets mode 0600, or the existing file's mode where that is stricter.
+func WriteConfigFile(path string, config Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if isYAML(path) {
+		var document yaml.Node
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return err
+		}
+		// Unmarshalling JSON as YAML leaves flow style behind, so switch back to block style
+		setBlockStyle(&document)
+		if data, err = yaml.Marshal(&document); err != nil {
+			return err
+		}
+	}
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm &= info.Mode().Perm()
+	}
+	return WriteFileAtomic(path, data, perm)
+}
+
+// WriteFileAtomic Writes data to a temporary file in the same directory as path and renames it over path.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// isYAML Reports whether path names a YAML file
+func isYAML(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	return extension == ".yaml" || extension == ".yml"
+}
+
+// setBlockStyle Clears flow style from every node
+func setBlockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle
+	for _, child := range node.Content {
+		setBlockStyle(child)
+	}
+}
+
+// parseEnviron Returns the CHUNCHUNMARU_* variables of environ, keyed by what follows the prefix
+func parseEnviron(environ []string) map[string]string {
+	env := make(map[string]string)
+	for _, variable := range environ {
+		key, value, found := strings.Cut(variable, "=")
+		if found && strings.HasPrefix(key, EnvPrefix) {
+			env[strings.TrimPrefix(key, EnvPrefix)] = value
+		}
+	}
+	return env
+}
+
+// configField A Config field that can be set from the environment or a flag
+type configField struct {
+	// name The field's JSON name in snake case
+	name  string
+	json  string
+	kind  reflect.Kind
+	usage string
+}
+
+// configFields Lists the fields of Config
+func configFields() []configField {
+	configType := reflect.TypeOf(Config{})
+	fields := make([]configField, 0, configType.NumField())
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		usage := fmt.Sprintf("overrides %s", tag)
+		switch field.Type.Kind() {
+		case reflect.Slice:
+			usage += " (comma separated)"
+		case reflect.Map:
+			usage += " (comma separated key=value pairs)"
+		}
+		fields = append(fields, configField{name: snakeCase(tag), json: tag, kind: field.Type.Kind(), usage: usage})
+	}
+	return fields
+}
+
+// snakeCase Converts camelCase JSON names such as minDelay to min_delay
+func snakeCase(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				builder.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// setConfigField Parses value into one field of config. Lists are comma separated and maps are comma separated
+// key=value pairs, though both may also be given as JSON.
+func setConfigField(config *Config, field configField, value string) error {
+	var raw json.RawMessage
+	switch field.kind {
+	case reflect.String:
+		raw, _ = json.Marshal(value)
+	case reflect.Slice:
+		if json.Valid([]byte(value)) {
+			raw = json.RawMessage(value)
+			break
+		}
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		raw, _ = json.Marshal(items)
+	case reflect.Map:
+		if json.Valid([]byte(value)) {
+			raw = json.RawMessage(value)
+			break
+		}
+		pairs := make(map[string]json.RawMessage)
+		for _, pair := range strings.Split(value, ",") {
+			key, item, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found {
+				return errors.New("expected comma separated key=value pairs")
+			}
+			item = strings.TrimSpace(item)
+			if !json.Valid([]byte(item)) {
+				return fmt.Errorf("invalid value %q for %s", item, key)
+			}
+			pairs[strings.TrimSpace(key)] = json.RawMessage(item)
+		}
+		raw, _ = json.Marshal(pairs)
+	default:
+		// Numbers and booleans are valid JSON already. Anything else, such as a duration like 5s, is passed as a string.
+		if json.Valid([]byte(value)) {
+			raw = json.RawMessage(value)
+		} else {
+			raw, _ = json.Marshal(value)
+		}
+	}
+	document, err := json.Marshal(map[string]json.RawMessage{field.json: raw})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(document, config)
+}
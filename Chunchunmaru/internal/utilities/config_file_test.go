@@ -0,0 +1,94 @@
+package utilities
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunchunmaru.yaml")
+	file := "port: 9000\nminDelay: 2s\nhostname: http://file.example\ntrap_paths: [/file/]\nscore_weights:\n  honeypot: 0.5\n"
+	if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	environ := []string{
+		"CHUNCHUNMARU_CONFIG=" + path,
+		"CHUNCHUNMARU_PORT=9100",
+		"CHUNCHUNMARU_MAX_DELAY=10",
+		"CHUNCHUNMARU_TRAP_PATHS=/env/,/other/",
+		"CHUNCHUNMARU_SCORE_WEIGHTS=rate=2",
+		"UNRELATED=1",
+	}
+	config, loaded, err := LoadConfig([]string{"-port", "9200", "-hostname", "http://flag.example"}, environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != path {
+		t.Errorf("expected config from %s, got %s", path, loaded)
+	}
+	if config.Port != 9200 || config.HostName != "http://flag.example" {
+		t.Errorf("flags should win: port %d, hostname %s", config.Port, config.HostName)
+	}
+	if config.MinDelay != Duration(2*time.Second) || config.MaxDelay != Duration(10*time.Second) {
+		t.Errorf("unexpected delays %v, %v", config.MinDelay, config.MaxDelay)
+	}
+	if !reflect.DeepEqual(config.TrapPaths, []string{"/env/", "/other/"}) {
+		t.Errorf("environment should replace lists, got %v", config.TrapPaths)
+	}
+	if config.ScoreWeights["rate"] != 2 || config.ScoreWeights["honeypot"] != 0.5 || config.ScoreWeights["timing"] != 0.3 {
+		t.Errorf("maps should merge key by key, got %v", config.ScoreWeights)
+	}
+	if config.QueriesPerAggression != DefaultConfig().QueriesPerAggression {
+		t.Errorf("unset fields should keep their defaults")
+	}
+}
+
+func TestWriteConfigFileRoundTrip(t *testing.T) {
+	config := DefaultConfig()
+	config.Port = 1234
+	config.MinChunkDelay = Duration(75 * time.Millisecond)
+	config.TrapPaths = []string{"/trap/"}
+	for _, name := range []string{"config.yaml", "config.json"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := WriteConfigFile(path, config); err != nil {
+			t.Fatal(err)
+		}
+		read := DefaultConfig()
+		if err := ReadConfigFile(path, &read); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, config) {
+			t.Errorf("%s: round trip changed the config:\n%+v\n%+v", name, read, config)
+		}
+	}
+}
+
+func TestWriteConfigFileMode(t *testing.T) {
+	dir := t.TempDir()
+	// An existing mode of 0 stands for no file yet
+	for existing, want := range map[os.FileMode]os.FileMode{0: 0600, 0644: 0600, 0400: 0400, 0640: 0600} {
+		path := filepath.Join(dir, "config.json")
+		os.Remove(path)
+		if existing != 0 {
+			if err := os.WriteFile(path, []byte("{}"), existing); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, existing); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := WriteConfigFile(path, DefaultConfig()); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("existing mode %o: expected %o, got %o", existing, want, info.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package utilities
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FieldError One problem with one config field, named by its JSON name.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors Every problem Config.Validate found
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, fieldError := range v {
+		messages[i] = fieldError.Field + ": " + fieldError.Message
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// emailDomainPattern Matches the domain names email_domains accepts
+var emailDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+// aggregationLevels The keys AggregationWeights understands
+var aggregationLevels = []string{"ip", "subnet", "asn"}
+
+// Validate Checks every field and the relations between them, returning ValidationErrors listing each problem, or nil.
+func (c Config) Validate() error {
+	var errs ValidationErrors
+	check := func(ok bool, field, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	check(c.Port >= 0 && c.Port <= 65535, "port", "must be between 0 and 65535")
+	check(c.MinDelay >= 0, "minDelay", "must not be negative")
+	check(c.MaxDelay >= c.MinDelay, "maxDelay", "must be at least minDelay")
+
+	hostname, err := url.Parse(c.HostName)
+	check(err == nil && (hostname.Scheme == "http" || hostname.Scheme == "https") && hostname.Host != "",
+		"hostname", "must be an absolute http or https URL")
+	check(!strings.HasSuffix(c.HostName, "/"), "hostname", "must not end with a slash")
+	for i, path := range c.PathWhitelist {
+		check(strings.HasPrefix(path, "/"), fmt.Sprintf("path_whitelist[%d]", i), "must start with a slash")
+	}
+	check(c.MinSubpaths >= 1, "min_subpaths", "must be at least 1")
+	check(c.MaxSubpaths >= c.MinSubpaths, "max_subpaths", "must be at least min_subpaths")
+	check(c.QueriesPerAggression > 0, "queries_per_aggression", "must be positive")
+
+	check(c.ChunkSize > 0, "chunk_size", "must be positive")
+	check(c.MinChunkDelay >= 0, "min_chunk_delay", "must not be negative")
+	check(c.MaxChunkDelay >= c.MinChunkDelay, "max_chunk_delay", "must be at least min_chunk_delay")
+	check(c.MaxStreamTime >= 0, "max_stream_time", "must not be negative")
+
+	for i, path := range c.TrapPaths {
+		check(strings.HasPrefix(path, "/"), fmt.Sprintf("trap_paths[%d]", i), "must start with a slash")
+	}
+	check(c.SuspectAggression >= 0 && c.SuspectAggression <= 100, "suspect_aggression", "must be between 0 and 100")
+	check(c.AggressionHalfLife > 0, "aggression_half_life", "must be positive")
+	for _, name := range slices.Sorted(maps.Keys(c.ScoreWeights)) {
+		weight := c.ScoreWeights[name]
+		check(weight >= 0 && !math.IsInf(weight, 0) && !math.IsNaN(weight), "score_weights."+name, "must be a non-negative number")
+	}
+	check(!strings.ContainsAny(c.CookieName, " \t\r\n\"(),/:;<=>?@[\\]{}"), "cookie_name", "must be a valid cookie name")
+
+	for i, entry := range c.TrustedProxies {
+		var err error
+		if strings.Contains(entry, "/") {
+			_, err = netip.ParsePrefix(entry)
+		} else {
+			_, err = netip.ParseAddr(entry)
+		}
+		check(err == nil, fmt.Sprintf("trusted_proxies[%d]", i), "must be an IP address or CIDR")
+	}
+	check(c.IPv6Prefix >= 0 && c.IPv6Prefix <= 128, "ipv6_prefix", "must be between 0 and 128")
+	check(c.SubnetPrefixV4 >= 0 && c.SubnetPrefixV4 <= 32, "subnet_prefix_v4", "must be between 0 and 32")
+	check(c.SubnetPrefixV6 >= 0 && c.SubnetPrefixV6 <= 128, "subnet_prefix_v6", "must be between 0 and 128")
+	check(c.ASNDatabase == "" || FileExists(c.ASNDatabase), "asn_database", "file %s does not exist", c.ASNDatabase)
+	check(c.AggregationMode == "max" || c.AggregationMode == "weighted", "aggregation_mode", `must be "max" or "weighted"`)
+	for _, name := range slices.Sorted(maps.Keys(c.AggregationWeights)) {
+		weight := c.AggregationWeights[name]
+		field := "aggregation_weights." + name
+		check(slices.Contains(aggregationLevels, name), field, "must be one of %s", strings.Join(aggregationLevels, ", "))
+		check(weight >= 0 && !math.IsInf(weight, 0) && !math.IsNaN(weight), field, "must be a non-negative number")
+	}
+
+	check(c.RequestLogRetention >= 0, "request_log_retention", "must not be negative")
+	check(c.RequestLogMaxRows >= 0, "request_log_max_rows", "must not be negative")
+	check(c.RetentionInterval > 0, "retention_interval", "must be positive")
+	check(c.ClientRetention >= 0, "client_retention", "must not be negative")
+	check(c.FlushInterval >= 0, "flush_interval", "must not be negative")
+	check(c.HitQueueSize >= 0, "hit_queue_size", "must not be negative")
+	check(c.CacheSize >= 0, "cache_size", "must not be negative")
+	check(c.BindAddress == "" || isBindAddress(c.BindAddress), "bind_address", "must be an IP address or host name")
+	var emailWeight float64
+	for _, domain := range slices.Sorted(maps.Keys(c.EmailDomains)) {
+		weight := c.EmailDomains[domain]
+		field := "email_domains." + domain
+		check(domain == "*" || emailDomainPattern.MatchString(domain), field, `must be a domain name or "*"`)
+		check(weight >= 0 && !math.IsInf(weight, 0) && !math.IsNaN(weight), field, "must be a non-negative number")
+		emailWeight += weight
+	}
+	check(emailWeight > 0, "email_domains", "must give at least one domain a positive weight")
+	check(c.CorpusMaxFileSize > 0, "corpus_max_file_size", "must be positive")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout", "must be positive")
+
+	for _, name := range slices.Sorted(maps.Keys(c.AuthKeys)) {
+		key := c.AuthKeys[name]
+		field := "auth_keys." + name
+		check(name != "", field, "must have a name")
+		check(len(key.Secret) >= 16, field+".secret", "must be at least 16 characters")
+		check(key.Role == RoleRead || key.Role == RoleAdmin, field+".role", `must be "%s" or "%s"`, RoleRead, RoleAdmin)
+	}
+	check(c.AuthMaxSkew > 0, "auth_max_skew", "must be positive")
+	check(c.TemplateReloadInterval >= 0, "template_reload_interval", "must not be negative")
+	if c.AdminAddress != "" {
+		host, port, err := net.SplitHostPort(c.AdminAddress)
+		portNumber, portErr := strconv.Atoi(port)
+		check(err == nil && (host == "" || isBindAddress(host)) && portErr == nil && portNumber >= 0 && portNumber <= 65535,
+			"admin_address", "must be a host:port address")
+		check(err != nil || host != c.BindAddress || portNumber != c.Port, "admin_address", "must differ from the tarpit's address")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// isBindAddress Reports whether address is an IP address or host name a listener can bind to
+func isBindAddress(address string) bool {
+	if _, err := netip.ParseAddr(address); err == nil {
+		return true
+	}
+	return !strings.ContainsAny(address, " \t/:[]") && !strings.HasPrefix(address, "-")
+}
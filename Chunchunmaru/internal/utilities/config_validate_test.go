@@ -0,0 +1,103 @@
+package utilities
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	config := DefaultConfig()
+	config.MinSubpaths, config.MaxSubpaths = 4, 2
+	config.QueriesPerAggression = 0
+	config.AggregationMode = "sum"
+	config.EmailDomains = map[string]float64{"Not A Domain": 1, "*": -1}
+
+	var errs ValidationErrors
+	if !errors.As(config.Validate(), &errs) {
+		t.Fatal("expected validation errors")
+	}
+	fields := map[string]bool{}
+	for _, fieldError := range errs {
+		fields[fieldError.Field] = true
+	}
+	for _, field := range []string{"max_subpaths", "queries_per_aggression", "aggregation_mode", "email_domains.Not A Domain", "email_domains.*"} {
+		if !fields[field] {
+			t.Errorf("expected an error for %s, got %v", field, errs)
+		}
+	}
+}
+
+func TestConfigAPIPatch(t *testing.T) {
+	cm := NewConfigManager(DefaultConfig())
+
+	request := httptest.NewRequest(http.MethodPatch, "/config", strings.NewReader(`{"port": 9090, "score_weights": {"timing": null, "rate": 2}}`))
+	recorder := httptest.NewRecorder()
+	cm.ConfigAPI(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	config := cm.GetConfig()
+	if config.Port != 9090 || config.ScoreWeights["rate"] != 2 || config.MinSubpaths != DefaultConfig().MinSubpaths {
+		t.Fatalf("patch not applied as expected: %+v", config)
+	}
+	if _, ok := config.ScoreWeights["timing"]; ok {
+		t.Fatal("null should remove the timing weight")
+	}
+
+	request = httptest.NewRequest(http.MethodPatch, "/config", strings.NewReader(`{"queries_per_aggression": 0}`))
+	recorder = httptest.NewRecorder()
+	cm.ConfigAPI(recorder, request)
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", recorder.Code)
+	}
+	var reply struct {
+		Errors []FieldError `json:"errors"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&reply); err != nil || len(reply.Errors) != 1 || reply.Errors[0].Field != "queries_per_aggression" {
+		t.Fatalf("unexpected rejection %+v, %v", reply, err)
+	}
+	if cm.GetConfig().QueriesPerAggression == 0 {
+		t.Fatal("rejected patch was applied")
+	}
+
+	recorder = httptest.NewRecorder()
+	cm.ConfigAPI(recorder, httptest.NewRequest(http.MethodGet, "/config", nil))
+	var live Config
+	if err := json.NewDecoder(recorder.Body).Decode(&live); err != nil || live.Port != 9090 {
+		t.Fatalf("GET returned %+v, %v", live, err)
+	}
+}
+
+func TestConfigAPIKeepsSecret(t *testing.T) {
+	config := DefaultConfig()
+	config.Secret = "seed-secret"
+	cm := NewConfigManager(config)
+	// A whole config, but for the secret
+	replacement := DefaultConfig()
+	replacement.Port = 9090
+	body, _ := json.Marshal(replacement)
+	for _, request := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/config", bytes.NewReader(body)),
+		httptest.NewRequest(http.MethodPatch, "/config", strings.NewReader(`{"secret": null}`)),
+	} {
+		recorder := httptest.NewRecorder()
+		cm.ConfigAPI(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+		}
+		if secret := cm.GetConfig().Secret; secret != "seed-secret" {
+			t.Fatalf("%s without a secret changed it to %q", request.Method, secret)
+		}
+	}
+}
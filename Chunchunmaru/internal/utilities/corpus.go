@@ -0,0 +1,220 @@
+package utilities
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations Words that end in a full stop without ending the sentence, lowercased and without the final stop
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true, "mt": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true, "cf": true, "al": true, "approx": true, "no": true, "vol": true,
+	"fig": true, "inc": true, "ltd": true, "co": true, "corp": true, "dept": true, "est": true, "gen": true,
+	"gov": true, "lt": true, "col": true, "capt": true, "sgt": true, "rev": true, "u.s": true, "a.m": true, "p.m": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true, "sep": true,
+	"sept": true, "oct": true, "nov": true, "dec": true,
+}
+
+// sentenceEnders and sentenceClosers Punctuation that ends a sentence, and what may follow it inside the sentence
+const (
+	sentenceEnders  = ".!?…"
+	sentenceClosers = "\"'”’»)]"
+)
+
+// sentenceStarts Returns the byte offsets at which the sentences of text start. A sentence ends at a run of . ! ? or …
+// followed by space and something that can start a sentence, unless the full stop belongs to an abbreviation or an
+// initial, and at blank lines, so headings and list items don't run into each other.
+func sentenceStarts(text string) []int {
+	starts := []int{0}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == '\n' {
+			// A blank line, possibly holding spaces, always ends the sentence
+			j := i + size
+			for j < len(text) && (text[j] == ' ' || text[j] == '\t' || text[j] == '\r') {
+				j++
+			}
+			if j < len(text) && text[j] == '\n' {
+				for j < len(text) && unicode.IsSpace(rune(text[j])) {
+					j++
+				}
+				if j < len(text) {
+					starts = append(starts, j)
+				}
+				i = j
+				continue
+			}
+			i += size
+			continue
+		}
+		if !strings.ContainsRune(sentenceEnders, r) {
+			i += size
+			continue
+		}
+
+		end := i + size
+		for end < len(text) {
+			next, nextSize := utf8.DecodeRuneInString(text[end:])
+			if !strings.ContainsRune(sentenceEnders, next) && !strings.ContainsRune(sentenceClosers, next) {
+				break
+			}
+			end += nextSize
+		}
+		start := end
+		for start < len(text) {
+			next, nextSize := utf8.DecodeRuneInString(text[start:])
+			if !unicode.IsSpace(next) {
+				break
+			}
+			start += nextSize
+		}
+		if start == end || start == len(text) {
+			// Not followed by space, as in 3.14 or example.com, or at the very end
+			i = end
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(text[start:]); !unicode.IsUpper(next) && !unicode.IsDigit(next) &&
+			!strings.ContainsRune("\"'“‘«([¿¡", next) {
+			i = end
+			continue
+		}
+		if r == '.' && end == i+size && isAbbreviation(text[:i]) {
+			i = end
+			continue
+		}
+		starts = append(starts, start)
+		i = start
+	}
+	return starts
+}
+
+// isAbbreviation Reports whether the word at the end of text, just before a full stop, is an abbreviation or initial
+func isAbbreviation(text string) bool {
+	word := text[strings.LastIndexFunc(text, unicode.IsSpace)+1:]
+	word = strings.TrimLeft(word, sentenceClosers+"“‘«(")
+	if utf8.RuneCountInString(word) == 1 {
+		r, _ := utf8.DecodeRuneInString(word)
+		return unicode.IsUpper(r)
+	}
+	return abbreviations[strings.ToLower(word)]
+}
+
+// SplitSentences Splits text into sentences, trimmed of surrounding space
+func SplitSentences(text string) []string {
+	starts := sentenceStarts(text)
+	sentences := make([]string, 0, len(starts))
+	for i, start := range starts {
+		end := len(text)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		if sentence := strings.TrimSpace(text[start:end]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+	return sentences
+}
+
+// Tokenize Splits a sentence into the tokens a Markov chain learns. The sentence's final punctuation is dropped, as
+// generated sentences get their own full stop.
+func Tokenize(sentence string) []string {
+	body := strings.TrimRight(sentence, sentenceClosers)
+	closers := sentence[len(body):]
+	body = strings.TrimRight(body, sentenceEnders)
+	tokens := strings.Fields(body + closers)
+	if len(tokens) == 0 || len(tokens) == 1 && strings.Trim(tokens[0], sentenceClosers) == "" {
+		return nil
+	}
+	return tokens
+}
+
+// skippedElements HTML elements whose content isn't text a reader would see
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true, "head": true, "iframe": true,
+	"object": true, "canvas": true, "select": true,
+}
+
+// blockElements HTML elements that separate their text from what comes before and after
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "hr": true, "li": true, "ul": true, "ol": true, "dl": true, "dt": true,
+	"dd": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "title": true, "tr": true,
+	"td": true, "th": true, "table": true, "section": true, "article": true, "header": true, "footer": true,
+	"nav": true, "aside": true, "main": true, "blockquote": true, "pre": true, "figcaption": true, "form": true,
+	"button": true, "label": true, "option": true, "body": true, "html": true,
+}
+
+// ExtractHTMLText Returns the readable text of an HTML document, with entities decoded, white space collapsed, scripts,
+// styles and the like left out, and a blank line wherever a block element starts or ends so sentences don't run
+// across them.
+func ExtractHTMLText(source string) string {
+	var builder strings.Builder
+	skipping := ""
+	for len(source) > 0 {
+		open := strings.IndexByte(source, '<')
+		if open < 0 {
+			open = len(source)
+		}
+		if skipping == "" {
+			builder.WriteString(collapseSpace(html.UnescapeString(source[:open])))
+		}
+		source = source[open:]
+		if source == "" {
+			break
+		}
+
+		if strings.HasPrefix(source, "<!--") {
+			end := strings.Index(source, "-->")
+			if end < 0 {
+				break
+			}
+			source = source[end+len("-->"):]
+			continue
+		}
+		end := strings.IndexByte(source, '>')
+		if end < 0 {
+			break
+		}
+		tag := source[1:end]
+		source = source[end+1:]
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.TrimLeft(tag, "/"))
+		if cut := strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || r == '/' }); cut >= 0 {
+			name = name[:cut]
+		}
+		switch {
+		case skipping != "":
+			if closing && name == skipping {
+				skipping = ""
+			}
+		case skippedElements[name] && !closing && !strings.HasSuffix(tag, "/"):
+			skipping = name
+		case blockElements[name]:
+			builder.WriteString("\n\n")
+		}
+	}
+	return builder.String()
+}
+
+// collapseSpace Replaces each run of white space in text with a single space, as browsers do
+func collapseSpace(text string) string {
+	var builder strings.Builder
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			builder.WriteByte(' ')
+			space = false
+		}
+		builder.WriteRune(r)
+	}
+	if space {
+		builder.WriteByte(' ')
+	}
+	return builder.String()
+}
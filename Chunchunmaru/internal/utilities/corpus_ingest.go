@@ -0,0 +1,350 @@
+package utilities
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/mb-14/gomarkov"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Training defaults. A new model's order is picked by autoOrder from the first orderSampleTokens tokens of its corpus.
+const (
+	defaultMaxOrder           = 5
+	defaultMinSamplesPerState = 2.0
+	orderSampleTokens         = 200000
+	// progressTokens How many tokens are learned between progress reports
+	progressTokens = 100000
+	// pendingTextLimit How much streamed text is held before its finished sentences are learned, and maxPendingText
+	// the most before the text is learned even if no sentence in it has ended
+	pendingTextLimit = 64 * 1024
+	maxPendingText   = 1024 * 1024
+	// maxJSONLLine The longest JSONL record accepted
+	maxJSONLLine = 16 * 1024 * 1024
+)
+
+// CorpusStats How much of a corpus has been learned
+type CorpusStats struct {
+	Files     int `json:"files"`
+	Sentences int `json:"sentences"`
+	Tokens    int `json:"tokens"`
+}
+
+// CorpusTrainer Teaches a Markov chain a corpus as it is read, without holding the whole corpus in memory. Plain text is
+// written to it like a file, and each document is ended with EndDocument.
+type CorpusTrainer struct {
+	chain    *gomarkov.Chain
+	progress func(CorpusStats)
+	stats    CorpusStats
+	reported int
+	// pending Streamed text whose last sentence may not be finished yet
+	pending []byte
+	// sample Sentences held until there are enough tokens to choose a new chain's order
+	sample       [][]string
+	sampleTokens int
+	// fingerprints Fingerprints of the sentences learned
+	fingerprints []uint64
+}
+
+// NewCorpusTrainer Returns a trainer adding to chain, or to a new chain if it is nil. progress, if not nil, is called
+// every so many tokens.
+func NewCorpusTrainer(chain *gomarkov.Chain, progress func(CorpusStats)) *CorpusTrainer {
+	return &CorpusTrainer{chain: chain, progress: progress}
+}
+
+// Write Adds streamed plain text, learning the sentences that are known to be finished
+func (ct *CorpusTrainer) Write(p []byte) (int, error) {
+	ct.pending = append(ct.pending, p...)
+	if len(ct.pending) >= pendingTextLimit {
+		text := string(ct.pending)
+		starts := sentenceStarts(text)
+		last := starts[len(starts)-1]
+		if last == 0 && len(text) >= maxPendingText {
+			last = len(text)
+		}
+		ct.learnText(text[:last])
+		ct.pending = append(ct.pending[:0], text[last:]...)
+	}
+	return len(p), nil
+}
+
+// EndDocument Learns what is left of the current document and counts it
+func (ct *CorpusTrainer) EndDocument() {
+	ct.learnText(string(ct.pending))
+	ct.pending = ct.pending[:0]
+	ct.stats.Files++
+}
+
+// AddDocument Learns a whole document
+func (ct *CorpusTrainer) AddDocument(text string) {
+	ct.learnText(text)
+	ct.stats.Files++
+}
+
+// learnText Learns every sentence in text
+func (ct *CorpusTrainer) learnText(text string) {
+	for _, sentence := range SplitSentences(text) {
+		tokens := Tokenize(sentence)
+		if len(tokens) == 0 {
+			continue
+		}
+		ct.stats.Sentences++
+		ct.stats.Tokens += len(tokens)
+		ct.fingerprints = append(ct.fingerprints, sentenceFingerprint(tokens))
+		if ct.chain == nil {
+			ct.sample = append(ct.sample, tokens)
+			if ct.sampleTokens += len(tokens); ct.sampleTokens >= orderSampleTokens {
+				ct.startChain()
+			}
+		} else {
+			ct.chain.Add(tokens)
+		}
+		if ct.progress != nil && ct.stats.Tokens-ct.reported >= progressTokens {
+			ct.reported = ct.stats.Tokens
+			ct.progress(ct.stats)
+		}
+	}
+}
+
+// startChain Creates the chain with an order suited to the sampled sentences and teaches it them
+func (ct *CorpusTrainer) startChain() {
+	var tokens []string
+	for _, sentence := range ct.sample {
+		tokens = append(tokens, sentence...)
+	}
+	ct.chain = gomarkov.NewChain(autoOrderTokens(tokens, defaultMaxOrder, defaultMinSamplesPerState))
+	for _, sentence := range ct.sample {
+		ct.chain.Add(sentence)
+	}
+	ct.sample, ct.sampleTokens = nil, 0
+}
+
+// Finish Learns any text still pending and returns the chain with what was learned. The chain is nil if nothing was.
+func (ct *CorpusTrainer) Finish() (*gomarkov.Chain, CorpusStats) {
+	if len(ct.pending) > 0 {
+		ct.learnText(string(ct.pending))
+		ct.pending = ct.pending[:0]
+	}
+	if ct.chain == nil && len(ct.sample) > 0 {
+		ct.startChain()
+	}
+	if ct.progress != nil && ct.reported != ct.stats.Tokens {
+		ct.reported = ct.stats.Tokens
+		ct.progress(ct.stats)
+	}
+	return ct.chain, ct.stats
+}
+
+// corpusExtensions The files taken from archives
+var corpusExtensions = map[string]bool{".txt": true, ".md": true, ".html": true, ".htm": true, ".jsonl": true}
+
+// ReadCorpus Feeds a corpus file to trainer. The format is told from name and the content: gzip, tar and zip archives,
+// whose .txt, .md, .html and .jsonl files are read in turn, JSONL with a string or an object with a "text", "content"
+// or "body" field per line, HTML, whose text is extracted, and anything else as plain text. Files in archives are never
+// taken for archives themselves, though a gzip file may hold a tar archive. maxSize caps the bytes of an HTML document
+// read into memory and of a zip archive spooled to disk.
+func ReadCorpus(name string, r io.Reader, maxSize int64, trainer *CorpusTrainer) error {
+	buffered := bufio.NewReaderSize(r, 64*1024)
+	head, _ := buffered.Peek(512)
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer gz.Close()
+		inner := strings.TrimSuffix(name, path.Ext(name))
+		if strings.HasSuffix(strings.ToLower(name), ".tgz") {
+			inner += ".tar"
+		}
+		unpacked := bufio.NewReaderSize(gz, 64*1024)
+		innerHead, _ := unpacked.Peek(512)
+		if isTar(inner, innerHead) {
+			return readTarCorpus(inner, unpacked, maxSize, trainer)
+		}
+		return readDocument(inner, unpacked, maxSize, trainer)
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return readZipCorpus(name, buffered, maxSize, trainer)
+	case isTar(name, head):
+		return readTarCorpus(name, buffered, maxSize, trainer)
+	}
+	return readDocument(name, buffered, maxSize, trainer)
+}
+
+// isTar Reports whether a file is a tar archive, by its name or the magic in its header
+func isTar(name string, head []byte) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".tar") || len(head) > 262 && string(head[257:262]) == "ustar"
+}
+
+// readDocument Feeds a single text, Markdown, HTML or JSONL file to trainer
+func readDocument(name string, r io.Reader, maxSize int64, trainer *CorpusTrainer) error {
+	buffered := bufio.NewReaderSize(r, 64*1024)
+	head, _ := buffered.Peek(512)
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".jsonl") || strings.HasSuffix(lower, ".ndjson"):
+		return readJSONLCorpus(name, buffered, trainer)
+	case strings.HasSuffix(lower, ".html") || strings.HasSuffix(lower, ".htm") || looksLikeHTML(head):
+		source, err := io.ReadAll(io.LimitReader(buffered, maxSize+1))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if int64(len(source)) > maxSize {
+			return fmt.Errorf("%s: HTML larger than %d bytes", name, maxSize)
+		}
+		trainer.AddDocument(ExtractHTMLText(string(source)))
+		return nil
+	case strings.HasSuffix(lower, ".md"):
+		return readMarkdownCorpus(name, buffered, trainer)
+	}
+	if _, err := io.Copy(trainer, buffered); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	trainer.EndDocument()
+	return nil
+}
+
+// looksLikeHTML Reports whether a file starts like an HTML document
+func looksLikeHTML(head []byte) bool {
+	start := strings.ToLower(strings.TrimSpace(string(head)))
+	return strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html")
+}
+
+// readTarCorpus Reads the corpus files in a tar archive
+func readTarCorpus(name string, r io.Reader, maxSize int64, trainer *CorpusTrainer) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if header.Typeflag != tar.TypeReg || !corpusExtensions[strings.ToLower(path.Ext(header.Name))] {
+			continue
+		}
+		if err := readDocument(header.Name, archive, maxSize, trainer); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+}
+
+// readZipCorpus Reads the corpus files in a zip archive. Zip keeps its index at the end, so a stream of up to maxSize
+// bytes is spooled to a temporary file first.
+func readZipCorpus(name string, r io.Reader, maxSize int64, trainer *CorpusTrainer) error {
+	spool, err := os.CreateTemp("", "chunchunmaru-corpus-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	size, err := io.Copy(spool, io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if size > maxSize {
+		return fmt.Errorf("%s: zip archive larger than %d bytes", name, maxSize)
+	}
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !corpusExtensions[strings.ToLower(path.Ext(file.Name))] {
+			continue
+		}
+		content, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		err = readDocument(file.Name, content, maxSize, trainer)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// readJSONLCorpus Reads one document per line of JSONL
+func readJSONLCorpus(name string, r io.Reader, trainer *CorpusTrainer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLLine)
+	for line := 1; scanner.Scan(); line++ {
+		record := bytes.TrimSpace(scanner.Bytes())
+		if len(record) == 0 {
+			continue
+		}
+		var text string
+		if record[0] == '"' {
+			if err := json.Unmarshal(record, &text); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		} else {
+			var fields struct {
+				Text    string `json:"text"`
+				Content string `json:"content"`
+				Body    string `json:"body"`
+			}
+			if err := json.Unmarshal(record, &fields); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+			text = fields.Text + fields.Content + fields.Body
+		}
+		trainer.AddDocument(text)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// readMarkdownCorpus Reads Markdown as plain text, leaving out code blocks and the markup around the text
+func readMarkdownCorpus(name string, r io.Reader, trainer *CorpusTrainer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLLine)
+	fenced := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		if fenced || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		// Headings and list items end a sentence even without a full stop
+		block := false
+		if heading := strings.TrimLeft(trimmed, "#"); heading != trimmed {
+			trimmed, block = heading, true
+		}
+		trimmed = strings.TrimSpace(strings.TrimLeft(trimmed, ">"))
+		for _, marker := range []string{"- ", "* ", "+ "} {
+			if strings.HasPrefix(trimmed, marker) {
+				trimmed, block = trimmed[len(marker):], true
+			}
+		}
+		if strings.HasPrefix(trimmed, "---") || strings.HasPrefix(trimmed, "|") {
+			trimmed = ""
+		}
+		trimmed = strings.NewReplacer("**", "", "__", "", "`", "").Replace(trimmed)
+		if trimmed == "" || block {
+			trainer.Write([]byte("\n\n" + trimmed + "\n\n"))
+		} else {
+			trainer.Write([]byte(trimmed + "\n"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	trainer.EndDocument()
+	return nil
+}
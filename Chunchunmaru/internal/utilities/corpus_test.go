@@ -0,0 +1,116 @@
+package utilities
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	for text, want := range map[string][]string{
+		"Dr. Smith paid $3.50 at example.com. Then he left!":    {"Dr. Smith paid $3.50 at example.com.", "Then he left!"},
+		"J. R. R. Tolkien wrote it. \"Really?\" she asked. Yes": {"J. R. R. Tolkien wrote it.", "\"Really?\" she asked.", "Yes"},
+		"Wait... what? no, fine.":                               {"Wait... what? no, fine."},
+		"A Heading\n\nBody text, e.g. this. (Aside.) End":       {"A Heading", "Body text, e.g. this.", "(Aside.)", "End"},
+		"": {},
+	} {
+		if got := SplitSentences(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %q, got %q", text, want, got)
+		}
+	}
+
+	for sentence, want := range map[string][]string{
+		"Then he left!":       {"Then", "he", "left"},
+		"\"Stop right now!\"": {"\"Stop", "right", "now\""},
+		"...":                 nil,
+	} {
+		if got := Tokenize(sentence); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %q, got %q", sentence, want, got)
+		}
+	}
+}
+
+func TestExtractHTMLText(t *testing.T) {
+	source := `<!DOCTYPE html><html><head><title>Site</title><style>p { color: red }</style></head>
+<body><h1>Welcome</h1><p>Fish &amp; chips
+    are <b>great</b>.</p><script>var x = "<p>no</p>";</script><!-- <p>hidden</p> --><ul><li>One</li><li>Two</li></ul></body></html>`
+	want := []string{"Welcome", "Fish & chips are great.", "One", "Two"}
+	if got := SplitSentences(ExtractHTMLText(source)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestReadCorpus(t *testing.T) {
+	text := "The cat sat on the mat. The dog sat on the log."
+	var tarball bytes.Buffer
+	tarWriter := tar.NewWriter(&tarball)
+	for name, content := range map[string]string{"a.txt": text, "b.html": "<p>" + text + "</p>", "skip.bin": "Not read."} {
+		tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tarWriter.Write([]byte(content))
+	}
+	tarWriter.Close()
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write(tarball.Bytes())
+	gzipWriter.Close()
+	var zipped bytes.Buffer
+	zipWriter := zip.NewWriter(&zipped)
+	file, _ := zipWriter.Create("docs/c.md")
+	file.Write([]byte("# Title\n\n" + text + "\n\n```\ncode();\n```\n- item one\n"))
+	file, _ = zipWriter.Create("d.jsonl")
+	file.Write([]byte("\"" + text + "\"\n{\"text\": \"" + text + "\"}\n"))
+	zipWriter.Close()
+
+	for name, input := range map[string][]byte{
+		"corpus.tgz": gzipped.Bytes(),
+		"corpus.zip": zipped.Bytes(),
+		"plain":      []byte(strings.Repeat(text+" ", 20000)),
+	} {
+		trainer := NewCorpusTrainer(nil, nil)
+		if err := ReadCorpus(name, bytes.NewReader(input), 1<<20, trainer); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		chain, stats := trainer.Finish()
+		want := map[string]CorpusStats{
+			"corpus.tgz": {Files: 2, Sentences: 4, Tokens: 24},
+			"corpus.zip": {Files: 3, Sentences: 8, Tokens: 39},
+			"plain":      {Files: 1, Sentences: 40000, Tokens: 240000},
+		}[name]
+		if stats != want || chain == nil {
+			t.Errorf("%s: expected %+v, got %+v", name, want, stats)
+		}
+	}
+
+	if err := ReadCorpus("bad.jsonl", strings.NewReader("\"fine\"\n{broken\n"), 1<<20, NewCorpusTrainer(nil, nil)); err == nil || !strings.Contains(err.Error(), "bad.jsonl:2") {
+		t.Fatalf("expected the broken line to be reported, got %v", err)
+	}
+
+	// HTML and zip archives are only read up to the size limit
+	for name, input := range map[string][]byte{"big.html": []byte("<p>" + strings.Repeat(text, 100) + "</p>"), "corpus.zip": zipped.Bytes()} {
+		if err := ReadCorpus(name, bytes.NewReader(input), 100, NewCorpusTrainer(nil, nil)); err == nil || !strings.Contains(err.Error(), "larger than 100 bytes") {
+			t.Errorf("%s: expected the size limit to be enforced, got %v", name, err)
+		}
+	}
+
+	// Archives in archives are read as they are rather than unpacked
+	var nested bytes.Buffer
+	gzipWriter = gzip.NewWriter(&nested)
+	gzipWriter.Write([]byte(strings.Repeat(text+" ", 1000)))
+	gzipWriter.Close()
+	tarball.Reset()
+	tarWriter = tar.NewWriter(&tarball)
+	tarWriter.WriteHeader(&tar.Header{Name: "nested.txt", Mode: 0644, Size: int64(nested.Len()), Typeflag: tar.TypeReg})
+	tarWriter.Write(nested.Bytes())
+	tarWriter.Close()
+	trainer := NewCorpusTrainer(nil, nil)
+	if err := ReadCorpus("outer.tar", &tarball, 1<<20, trainer); err != nil {
+		t.Fatal(err)
+	}
+	if _, stats := trainer.Finish(); stats.Tokens >= 1000 {
+		t.Fatalf("expected the nested gzip file not to be unpacked, got %+v", stats)
+	}
+}
@@ -3,201 +3,220 @@ package utilities
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 // randomLength generates a random length value with a unit.
-func randomLength(min, max int, units ...string) string {
+func randomLength(r *rand.Rand, min, max int, units ...string) string {
 	if len(units) == 0 {
 		units = []string{"px", "em", "%", "rem", "vh", "vw"}
 	}
-	value := rand.Intn(max-min+1) + min
-	unit := units[rand.Intn(len(units))]
+	value := r.Intn(max-min+1) + min
+	unit := units[r.Intn(len(units))]
 	return strconv.Itoa(value) + unit
 }
 
 // randomFloat generates a random float value for properties like opacity or line-height.
-func randomFloat(min, max float64) string {
-	val := min + rand.Float64()*(max-min)
+func randomFloat(r *rand.Rand, min, max float64) string {
+	val := min + r.Float64()*(max-min)
 	return fmt.Sprintf("%.2f", val)
 }
 
 // randomShorthandLength generates a random shorthand value for margin or padding.
-func randomShorthandLength() string {
-	count := rand.Intn(4) + 1 // 1 to 4 values
+func randomShorthandLength(r *rand.Rand) string {
+	count := r.Intn(4) + 1 // 1 to 4 values
 	values := make([]string, count)
 	for i := 0; i < count; i++ {
-		values[i] = randomLength(0, 50, "px", "%", "em")
+		values[i] = randomLength(r, 0, 50, "px", "%", "em")
 	}
 	return strings.Join(values, " ")
 }
 
 // randomShadow generates a random box-shadow or text-shadow.
-func randomShadow() string {
-	hOffset := randomLength(-10, 10, "px")
-	vOffset := randomLength(-10, 10, "px")
-	blur := randomLength(0, 20, "px")
+func randomShadow(r *rand.Rand) string {
+	hOffset := randomLength(r, -10, 10, "px")
+	vOffset := randomLength(r, -10, 10, "px")
+	blur := randomLength(r, 0, 20, "px")
 	spread := ""
 	inset := ""
 
 	// box-shadow can have spread and inset
-	if rand.Intn(2) == 0 {
-		spread = " " + randomLength(0, 15, "px")
-		if rand.Intn(3) == 0 {
+	if r.Intn(2) == 0 {
+		spread = " " + randomLength(r, 0, 15, "px")
+		if r.Intn(3) == 0 {
 			inset = " inset"
 		}
 	}
-	color := RandomHexColor()
+	color := RandomHexColor(r)
 	return fmt.Sprintf("%s %s %s%s %s%s", hOffset, vOffset, blur, spread, color, inset)
 }
 
 // randomGridTemplate generates a value for grid-template-columns/rows.
-func randomGridTemplate() string {
+func randomGridTemplate(r *rand.Rand) string {
 	parts := []string{}
-	for i := 0; i < rand.Intn(4)+1; i++ { // 1 to 4 tracks
-		partType := rand.Intn(3)
+	for i := 0; i < r.Intn(4)+1; i++ { // 1 to 4 tracks
+		partType := r.Intn(3)
 		switch partType {
 		case 0:
-			parts = append(parts, randomLength(20, 200, "px", "em"))
+			parts = append(parts, randomLength(r, 20, 200, "px", "em"))
 		case 1:
-			parts = append(parts, randomLength(10, 100, "%"))
+			parts = append(parts, randomLength(r, 10, 100, "%"))
 		case 2:
-			parts = append(parts, fmt.Sprintf("%dfr", rand.Intn(4)+1))
+			parts = append(parts, fmt.Sprintf("%dfr", r.Intn(4)+1))
 		}
 	}
 	return strings.Join(parts, " ")
 }
 
 // randomTransition generates a value for the transition shorthand property.
-func randomTransition() string {
-	property := RandomKeyword([]string{"all", "opacity", "transform", "background-color", "color"})
-	duration := fmt.Sprintf("%.2fs", 0.1+rand.Float64()*1.9) // 0.1s to 2.0s
-	timingFunction := RandomKeyword([]string{"ease", "ease-in", "ease-out", "ease-in-out", "linear", "step-start"})
-	delay := fmt.Sprintf("%.2fs", rand.Float64()*0.5) // 0s to 0.5s
+func randomTransition(r *rand.Rand) string {
+	property := RandomKeyword(r, []string{"all", "opacity", "transform", "background-color", "color"})
+	duration := fmt.Sprintf("%.2fs", 0.1+r.Float64()*1.9) // 0.1s to 2.0s
+	timingFunction := RandomKeyword(r, []string{"ease", "ease-in", "ease-out", "ease-in-out", "linear", "step-start"})
+	delay := fmt.Sprintf("%.2fs", r.Float64()*0.5) // 0s to 0.5s
 	return fmt.Sprintf("%s %s %s %s", property, duration, timingFunction, delay)
 }
 
 // randomClipPath generates a simple clip-path value.
-func randomClipPath() string {
+func randomClipPath(r *rand.Rand) string {
 	shapes := []string{
-		fmt.Sprintf("circle(%s at %s %s)", randomLength(25, 50, "%"), randomLength(25, 75, "%"), randomLength(25, 75, "%")),
-		fmt.Sprintf("ellipse(%s %s at 50%% 50%%)", randomLength(25, 50, "%"), randomLength(25, 50, "%")),
-		fmt.Sprintf("polygon(%s %s, %s %s, %s %s)", randomLength(0, 100, "%"), randomLength(0, 100, "%"), randomLength(0, 100, "%"), randomLength(0, 100, "%"), randomLength(0, 100, "%"), randomLength(0, 100, "%")),
+		fmt.Sprintf("circle(%s at %s %s)", randomLength(r, 25, 50, "%"), randomLength(r, 25, 75, "%"), randomLength(r, 25, 75, "%")),
+		fmt.Sprintf("ellipse(%s %s at 50%% 50%%)", randomLength(r, 25, 50, "%"), randomLength(r, 25, 50, "%")),
+		fmt.Sprintf("polygon(%s %s, %s %s, %s %s)", randomLength(r, 0, 100, "%"), randomLength(r, 0, 100, "%"), randomLength(r, 0, 100, "%"), randomLength(r, 0, 100, "%"), randomLength(r, 0, 100, "%"), randomLength(r, 0, 100, "%")),
 		"inset(10% 20% 30% 40% round 10px)",
 	}
-	return RandomKeyword(shapes)
+	return RandomKeyword(r, shapes)
 }
 
-var cssProperties = map[string]func() string{
+var cssProperties = map[string]func(r *rand.Rand) string{
 	// --- Text & Font Properties ---
-	"color": func() string {
-		return RandomKeyword([]string{"red", "blue", "green", "purple", "orange", "pink", "brown", "black", "white", RandomHexColor()})
+	"color": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"red", "blue", "green", "purple", "orange", "pink", "brown", "black", "white", RandomHexColor(r)})
 	},
-	"font-size": func() string { return randomLength(12, 48, "px", "em", "rem") },
-	"font-family": func() string {
-		return RandomKeyword([]string{`"Arial", sans-serif`, `"Georgia", serif`, `"Courier New", monospace`, `"Verdana", sans-serif`, `"Times New Roman", serif`})
+	"font-size": func(r *rand.Rand) string { return randomLength(r, 12, 48, "px", "em", "rem") },
+	"font-family": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{`"Arial", sans-serif`, `"Georgia", serif`, `"Courier New", monospace`, `"Verdana", sans-serif`, `"Times New Roman", serif`})
 	},
-	"font-style": func() string { return RandomKeyword([]string{"normal", "italic", "oblique"}) },
-	"font-weight": func() string {
-		return RandomKeyword([]string{"normal", "bold", "bolder", "lighter", "100", "400", "700", "900"})
+	"font-style": func(r *rand.Rand) string { return RandomKeyword(r, []string{"normal", "italic", "oblique"}) },
+	"font-weight": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"normal", "bold", "bolder", "lighter", "100", "400", "700", "900"})
 	},
-	"font-variant": func() string { return RandomKeyword([]string{"normal", "small-caps"}) },
-	"text-align":   func() string { return RandomKeyword([]string{"left", "right", "center", "justify"}) },
-	"text-decoration": func() string {
-		return fmt.Sprintf("%s %s %s", RandomKeyword([]string{"none", "underline", "overline", "line-through"}), RandomKeyword([]string{"solid", "wavy", "dotted"}), RandomHexColor())
+	"font-variant": func(r *rand.Rand) string { return RandomKeyword(r, []string{"normal", "small-caps"}) },
+	"text-align":   func(r *rand.Rand) string { return RandomKeyword(r, []string{"left", "right", "center", "justify"}) },
+	"text-decoration": func(r *rand.Rand) string {
+		return fmt.Sprintf("%s %s %s", RandomKeyword(r, []string{"none", "underline", "overline", "line-through"}), RandomKeyword(r, []string{"solid", "wavy", "dotted"}), RandomHexColor(r))
+	},
+	"text-transform": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"none", "capitalize", "uppercase", "lowercase"})
 	},
-	"text-transform": func() string { return RandomKeyword([]string{"none", "capitalize", "uppercase", "lowercase"}) },
 	"text-shadow":    randomShadow,
-	"text-indent":    func() string { return randomLength(0, 100, "px", "%") },
-	"line-height":    func() string { return randomFloat(1, 2.5) },
-	"letter-spacing": func() string { return randomLength(-2, 10, "px") },
-	"word-spacing":   func() string { return randomLength(0, 15, "px", "em") },
-	"white-space":    func() string { return RandomKeyword([]string{"normal", "nowrap", "pre", "pre-wrap"}) },
-	"writing-mode":   func() string { return RandomKeyword([]string{"horizontal-tb", "vertical-rl", "vertical-lr"}) },
+	"text-indent":    func(r *rand.Rand) string { return randomLength(r, 0, 100, "px", "%") },
+	"line-height":    func(r *rand.Rand) string { return randomFloat(r, 1, 2.5) },
+	"letter-spacing": func(r *rand.Rand) string { return randomLength(r, -2, 10, "px") },
+	"word-spacing":   func(r *rand.Rand) string { return randomLength(r, 0, 15, "px", "em") },
+	"white-space":    func(r *rand.Rand) string { return RandomKeyword(r, []string{"normal", "nowrap", "pre", "pre-wrap"}) },
+	"writing-mode": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"horizontal-tb", "vertical-rl", "vertical-lr"})
+	},
 
 	// --- Box Model ---
-	"width":   func() string { return RandomKeyword([]string{"auto", randomLength(20, 100, "%", "px", "vw")}) },
-	"height":  func() string { return RandomKeyword([]string{"auto", randomLength(20, 100, "%", "px", "vh")}) },
+	"width": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"auto", randomLength(r, 20, 100, "%", "px", "vw")})
+	},
+	"height": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"auto", randomLength(r, 20, 100, "%", "px", "vh")})
+	},
 	"margin":  randomShorthandLength,
 	"padding": randomShorthandLength,
-	"border": func() string {
-		return fmt.Sprintf("%s %s %s", randomLength(1, 12, "px"), RandomKeyword([]string{"solid", "dotted", "dashed", "double"}), RandomHexColor())
+	"border": func(r *rand.Rand) string {
+		return fmt.Sprintf("%s %s %s", randomLength(r, 1, 12, "px"), RandomKeyword(r, []string{"solid", "dotted", "dashed", "double"}), RandomHexColor(r))
 	},
-	"border-radius": func() string { return randomLength(0, 50, "%", "px") },
+	"border-radius": func(r *rand.Rand) string { return randomLength(r, 0, 50, "%", "px") },
 	"box-shadow":    randomShadow,
-	"box-sizing":    func() string { return RandomKeyword([]string{"content-box", "border-box"}) },
+	"box-sizing":    func(r *rand.Rand) string { return RandomKeyword(r, []string{"content-box", "border-box"}) },
 
 	// --- Positioning ---
-	"position": func() string { return RandomKeyword([]string{"static", "relative", "absolute", "fixed", "sticky"}) },
-	"top":      func() string { return randomLength(-50, 100, "px", "%") },
-	"right":    func() string { return randomLength(-50, 100, "px", "%") },
-	"bottom":   func() string { return randomLength(-50, 100, "px", "%") },
-	"left":     func() string { return randomLength(-50, 100, "px", "%") },
-	"overflow": func() string { return RandomKeyword([]string{"visible", "hidden", "scroll", "auto"}) },
-	"z-index":  func() string { return strconv.Itoa(rand.Intn(1000) - 500) },
+	"position": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"static", "relative", "absolute", "fixed", "sticky"})
+	},
+	"top":      func(r *rand.Rand) string { return randomLength(r, -50, 100, "px", "%") },
+	"right":    func(r *rand.Rand) string { return randomLength(r, -50, 100, "px", "%") },
+	"bottom":   func(r *rand.Rand) string { return randomLength(r, -50, 100, "px", "%") },
+	"left":     func(r *rand.Rand) string { return randomLength(r, -50, 100, "px", "%") },
+	"overflow": func(r *rand.Rand) string { return RandomKeyword(r, []string{"visible", "hidden", "scroll", "auto"}) },
+	"z-index":  func(r *rand.Rand) string { return strconv.Itoa(r.Intn(1000) - 500) },
 
 	// --- Background ---
 	"background-color": RandomHexColor,
-	"background-image": func() string {
-		return fmt.Sprintf("linear-gradient(%sdeg, %s, %s)", strconv.Itoa(rand.Intn(361)), RandomHexColor(), RandomHexColor())
+	"background-image": func(r *rand.Rand) string {
+		return fmt.Sprintf("linear-gradient(%sdeg, %s, %s)", strconv.Itoa(r.Intn(361)), RandomHexColor(r), RandomHexColor(r))
 	},
-	"background-size":     func() string { return RandomKeyword([]string{"auto", "cover", "contain"}) },
-	"background-repeat":   func() string { return RandomKeyword([]string{"repeat", "no-repeat", "repeat-x", "repeat-y"}) },
-	"background-position": func() string { return fmt.Sprintf("%s %s", randomLength(0, 100, "%"), randomLength(0, 100, "%")) },
-	"background-blend-mode": func() string {
-		return RandomKeyword([]string{"normal", "multiply", "screen", "overlay", "darken", "lighten", "color-dodge"})
+	"background-size": func(r *rand.Rand) string { return RandomKeyword(r, []string{"auto", "cover", "contain"}) },
+	"background-repeat": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"repeat", "no-repeat", "repeat-x", "repeat-y"})
 	},
-	"background-attachment": func() string { return RandomKeyword([]string{"scroll", "fixed", "local"}) },
+	"background-position": func(r *rand.Rand) string {
+		return fmt.Sprintf("%s %s", randomLength(r, 0, 100, "%"), randomLength(r, 0, 100, "%"))
+	},
+	"background-blend-mode": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"normal", "multiply", "screen", "overlay", "darken", "lighten", "color-dodge"})
+	},
+	"background-attachment": func(r *rand.Rand) string { return RandomKeyword(r, []string{"scroll", "fixed", "local"}) },
 
 	// --- Flexbox (Container & Items) ---
-	"display": func() string {
-		return RandomKeyword([]string{"block", "inline", "inline-block", "flex", "grid", "none"})
+	"display": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"block", "inline", "inline-block", "flex", "grid", "none"})
 	},
-	"flex-direction": func() string { return RandomKeyword([]string{"row", "row-reverse", "column", "column-reverse"}) },
-	"justify-content": func() string {
-		return RandomKeyword([]string{"flex-start", "flex-end", "center", "space-between", "space-around", "space-evenly"})
+	"flex-direction": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"row", "row-reverse", "column", "column-reverse"})
 	},
-	"align-items": func() string {
-		return RandomKeyword([]string{"stretch", "flex-start", "flex-end", "center", "baseline"})
+	"justify-content": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"flex-start", "flex-end", "center", "space-between", "space-around", "space-evenly"})
 	},
-	"flex-wrap":   func() string { return RandomKeyword([]string{"nowrap", "wrap", "wrap-reverse"}) },
-	"flex-grow":   func() string { return strconv.Itoa(rand.Intn(5)) },
-	"flex-shrink": func() string { return strconv.Itoa(rand.Intn(5)) },
-	"order":       func() string { return strconv.Itoa(rand.Intn(10) - 5) },
+	"align-items": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"stretch", "flex-start", "flex-end", "center", "baseline"})
+	},
+	"flex-wrap":   func(r *rand.Rand) string { return RandomKeyword(r, []string{"nowrap", "wrap", "wrap-reverse"}) },
+	"flex-grow":   func(r *rand.Rand) string { return strconv.Itoa(r.Intn(5)) },
+	"flex-shrink": func(r *rand.Rand) string { return strconv.Itoa(r.Intn(5)) },
+	"order":       func(r *rand.Rand) string { return strconv.Itoa(r.Intn(10) - 5) },
 
 	// --- Grid (Container & Items) ---
 	"grid-template-columns": randomGridTemplate,
 	"grid-template-rows":    randomGridTemplate,
-	"grid-gap":              func() string { return randomLength(0, 50, "px", "em") },
-	"grid-auto-flow":        func() string { return RandomKeyword([]string{"row", "column", "dense"}) },
-	"grid-column":           func() string { return fmt.Sprintf("span %d", rand.Intn(3)+1) },
-	"grid-row":              func() string { return fmt.Sprintf("span %d", rand.Intn(3)+1) },
+	"grid-gap":              func(r *rand.Rand) string { return randomLength(r, 0, 50, "px", "em") },
+	"grid-auto-flow":        func(r *rand.Rand) string { return RandomKeyword(r, []string{"row", "column", "dense"}) },
+	"grid-column":           func(r *rand.Rand) string { return fmt.Sprintf("span %d", r.Intn(3)+1) },
+	"grid-row":              func(r *rand.Rand) string { return fmt.Sprintf("span %d", r.Intn(3)+1) },
 
 	// --- Transitions ---
-	"transition": func() string { return randomTransition() },
+	"transition": func(r *rand.Rand) string { return randomTransition(r) },
 
 	// --- Visual Effects & Miscellaneous ---
-	"opacity": func() string { return randomFloat(0.1, 1.0) },
-	"cursor": func() string {
-		return RandomKeyword([]string{"pointer", "default", "wait", "text", "move", "help", "crosshair"})
+	"opacity": func(r *rand.Rand) string { return randomFloat(r, 0.1, 1.0) },
+	"cursor": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"pointer", "default", "wait", "text", "move", "help", "crosshair"})
+	},
+	"visibility": func(r *rand.Rand) string { return RandomKeyword(r, []string{"visible", "hidden", "collapse"}) },
+	"transform": func(r *rand.Rand) string {
+		return fmt.Sprintf("rotate(%ddeg) scale(%.2f) skewX(%ddeg) translateX(%s)", r.Intn(361)-180, r.Float64()*1.5+0.5, r.Intn(91)-45, randomLength(r, -100, 100, "px"))
 	},
-	"visibility": func() string { return RandomKeyword([]string{"visible", "hidden", "collapse"}) },
-	"transform": func() string {
-		return fmt.Sprintf("rotate(%ddeg) scale(%.2f) skewX(%ddeg) translateX(%s)", rand.Intn(361)-180, rand.Float64()*1.5+0.5, rand.Intn(91)-45, randomLength(-100, 100, "px"))
+	"filter": func(r *rand.Rand) string {
+		return fmt.Sprintf("blur(%dpx) brightness(%.1f) saturate(%d%%)", r.Intn(10), r.Float64()*1.5+0.5, r.Intn(201))
 	},
-	"filter": func() string {
-		return fmt.Sprintf("blur(%dpx) brightness(%.1f) saturate(%d%%)", rand.Intn(10), rand.Float64()*1.5+0.5, rand.Intn(201))
+	"clip-path": randomClipPath,
+	"object-fit": func(r *rand.Rand) string {
+		return RandomKeyword(r, []string{"fill", "contain", "cover", "none", "scale-down"})
 	},
-	"clip-path":       randomClipPath,
-	"object-fit":      func() string { return RandomKeyword([]string{"fill", "contain", "cover", "none", "scale-down"}) },
-	"resize":          func() string { return RandomKeyword([]string{"none", "both", "horizontal", "vertical"}) },
-	"scroll-behavior": func() string { return RandomKeyword([]string{"auto", "smooth"}) },
+	"resize":          func(r *rand.Rand) string { return RandomKeyword(r, []string{"none", "both", "horizontal", "vertical"}) },
+	"scroll-behavior": func(r *rand.Rand) string { return RandomKeyword(r, []string{"auto", "smooth"}) },
 
 	// --- SVG Specific ---
 	"fill":         RandomHexColor,
 	"stroke":       RandomHexColor,
-	"stroke-width": func() string { return strconv.Itoa(rand.Intn(10) + 1) },
+	"stroke-width": func(r *rand.Rand) string { return strconv.Itoa(r.Intn(10) + 1) },
 }
 
 var keys []string
@@ -207,17 +226,19 @@ func init() {
 	for k := range cssProperties {
 		keys = append(keys, k)
 	}
+	// Map iteration order is random, so sort to keep seeded output stable across restarts.
+	sort.Strings(keys)
 }
 
 // --- Main CSS Generation Function ---
 
 // GenerateRandomInlineCSS creates a single random CSS property and value guaranteed to be inline-compatible.
-func GenerateRandomInlineCSS() string {
+func GenerateRandomInlineCSS(r *rand.Rand) string {
 	// Select a random property
-	property := keys[rand.Intn(len(keys))]
+	property := keys[r.Intn(len(keys))]
 
 	// Generate a random value for the selected property
-	value := cssProperties[property]()
+	value := cssProperties[property](r)
 
 	return property + ": " + value + ";"
 }
@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
-	"log"
 	"strings"
 )
 
@@ -16,12 +15,21 @@ type SqlTable struct {
 func OpenDatabase(filepath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", filepath)
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 	return db, nil
 }
 
+// OpenDatabaseReadOnly Opens an existing database without allowing any changes to it
+func OpenDatabaseReadOnly(filepath string) (*sql.DB, error) {
+	if !FileExists(filepath) {
+		return nil, fmt.Errorf("%s does not exist", filepath)
+	}
+	// Characters with a meaning in URIs are escaped, so the path is taken as it is
+	escaped := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(filepath)
+	return sql.Open("sqlite3", "file:"+escaped+"?mode=ro")
+}
+
 func CloseDatabase(db *sql.DB) {
 	db.Close()
 }
@@ -29,7 +37,6 @@ func CloseDatabase(db *sql.DB) {
 func CreateTable(db *sql.DB, table SqlTable) (sql.Result, error) {
 	result, err := db.Exec("CREATE TABLE IF NOT EXISTS `" + table.Name + "` (" + strings.Join(table.Columns, ", ") + ")")
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 	return result, nil
@@ -38,16 +45,18 @@ func CreateTable(db *sql.DB, table SqlTable) (sql.Result, error) {
 func DeleteTable(db *sql.DB, table *SqlTable) (sql.Result, error) {
 	result, err := db.Exec("DROP TABLE IF EXISTS `" + table.Name + "`")
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 	return result, nil
 }
 
-func InsertIntoTable(db *sql.DB, table *SqlTable, values []string) (sql.Result, error) {
-	result, err := db.Exec("insert into " + table.Name + " (" + strings.Join(table.Columns, ", ") + ") values(" + strings.Join(values, ", ") + ")")
+func InsertIntoTable(db *sql.DB, table *SqlTable, values []interface{}) (sql.Result, error) {
+	if len(values) != len(table.Columns) {
+		return nil, fmt.Errorf("column and value count mismatch")
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	result, err := db.Exec("insert into `"+table.Name+"` ("+strings.Join(table.Columns, ", ")+") values("+placeholders+")", values...)
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 	return result, nil
@@ -56,7 +65,6 @@ func InsertIntoTable(db *sql.DB, table *SqlTable, values []string) (sql.Result,
 func DeleteFromTable(db *sql.DB, table *SqlTable) (sql.Result, error) {
 	result, err := db.Exec("delete from " + table.Name)
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 	return result, nil
@@ -116,83 +124,6 @@ func ResetColumnForKey(db *sql.DB, table *SqlTable, targetColumn string, resetVa
 	return err
 }
 
-// Also GPT due to me not understanding SQL or GO well enough to marshal data types between both, although I now understand how the code works.
-// FetchAllIpInfo returns a slice of IpInfoStruct, one for each row in the table.
-func FetchAllIpInfo(db *sql.DB, table *SqlTable) ([]IpInfoStruct, error) {
-	// Validate columns exist
-	hasIp, hasQueries, hasAggression := false, false, false
-	for _, col := range table.Columns {
-		if col == "ip" {
-			hasIp = true
-		}
-		if col == "queries" {
-			hasQueries = true
-		}
-		if col == "aggression" {
-			hasAggression = true
-		}
-	}
-	if !hasIp || !hasQueries || !hasAggression {
-		return nil, fmt.Errorf("table %s must have 'ip', 'queries' and 'aggression' columns", table.Name)
-	}
-
-	query := fmt.Sprintf("SELECT ip, queries, aggression FROM %s", table.Name)
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var results []IpInfoStruct
-	for rows.Next() {
-		var info IpInfoStruct
-		// Marshal the data types
-		if err := rows.Scan(&info.Ip, &info.Queries, &info.Aggression); err != nil {
-			return nil, err
-		}
-		results = append(results, info)
-	}
-	return results, rows.Err()
-}
-
-// FetchAllUserAgentInfo Same as its sister function, except for user-agenting.
-func FetchAllUserAgentInfo(db *sql.DB, table *SqlTable) ([]UserAgentInfoStruct, error) {
-	// Validate columns exist
-	hasUa, hasQueries, hasAggression := false, false, false
-	for _, col := range table.Columns {
-		if col == "useragent" {
-			hasUa = true
-		}
-		if col == "queries" {
-			hasQueries = true
-		}
-		if col == "aggression" {
-			hasAggression = true
-		}
-	}
-	if !hasUa || !hasQueries || !hasAggression {
-		return nil, fmt.Errorf("table %s must have 'useragent', 'queries', and 'aggression' columns", table.Name)
-	}
-
-	query := fmt.Sprintf("SELECT useragent, queries, aggression FROM %s", table.Name)
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var results []UserAgentInfoStruct
-	for rows.Next() {
-		var info UserAgentInfoStruct
-		// Marshal the data types
-		if err := rows.Scan(&info.UserAgent, &info.Queries, &info.Aggression); err != nil {
-			return nil, err
-		}
-		results = append(results, info)
-	}
-	return results, rows.Err()
-}
-
 // WipeAllRows deletes all rows from the table but keeps the table structure.
 func WipeAllRows(db *sql.DB, table *SqlTable) error {
 	query := fmt.Sprintf("DELETE FROM %s", table.Name)
@@ -232,30 +163,3 @@ func UpsertRow(db *sql.DB, table SqlTable, values []interface{}) error {
 	_, err := db.Exec(query, values...)
 	return err
 }
-
-// More GPT function
-// SumQueries returns the sum of the 'queries' column for all rows in the table.
-func SumQueries(db *sql.DB, table *SqlTable) (int, error) {
-	// Validate that the table has a 'queries' column
-	hasQueries := false
-	for _, col := range table.Columns {
-		if col == "queries" {
-			hasQueries = true
-			break
-		}
-	}
-	if !hasQueries {
-		return 0, fmt.Errorf("table %s does not have a 'queries' column", table.Name)
-	}
-
-	query := fmt.Sprintf("SELECT SUM(queries) FROM %s", table.Name)
-	var sum sql.NullInt64
-	err := db.QueryRow(query).Scan(&sum)
-	if err != nil {
-		return 0, err
-	}
-	if !sum.Valid {
-		return 0, nil // No rows in table, so sum is 0
-	}
-	return int(sum.Int64), nil
-}
@@ -26,11 +26,11 @@ func init() {
 	AvgWordLen = int(len(embeddedWords) / WordCount())
 }
 
-func RandomWord() string {
+func RandomWord(r *rand.Rand) string {
 	if len(dict) == 0 {
 		return ""
 	}
-	return dict[rand.Intn(len(dict))]
+	return dict[r.Intn(len(dict))]
 }
 
 func WordCount() int {
@@ -10,8 +10,8 @@ import (
 	"strings"
 )
 
-// RandomHTMLFromDir selects a random .html file from dir and returns its contents as a string alongside the file name.
-func RandomHTMLFromDir(dir string) (string, string, error) {
+// RandomHTMLFromDir selects a random .html file from dir using r and returns its contents as a string alongside the file name.
+func RandomHTMLFromDir(dir string, r *rand.Rand) (string, string, error) {
 	files, err := os.ReadDir(dir)
 	if err != nil {
 		return "", "", err
@@ -28,7 +28,7 @@ func RandomHTMLFromDir(dir string) (string, string, error) {
 		return "", "", errors.New("no HTML files found in directory")
 	}
 
-	randomFile := htmlFiles[rand.Intn(len(htmlFiles))]
+	randomFile := htmlFiles[r.Intn(len(htmlFiles))]
 
 	content, err := os.ReadFile(randomFile)
 	if err != nil {
@@ -1,67 +1,262 @@
 package utilities
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/mb-14/gomarkov"
+	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-var MarkovModel *gomarkov.Chain
+// Where Markov models are kept. Every models/<name>.json is loaded as the model called name. DefaultModel is the one
+// used by macros that don't name a model; a model.json in the working directory from before models were named is
+// loaded as it when models/model.json doesn't exist.
+const (
+	ModelsDir        = "models"
+	DefaultModel     = "model"
+	legacyModelsFile = "model.json"
+)
 
-func TrainMarkovModel(data string, maxOrder int, minSamplesPerState float64, existingChain *gomarkov.Chain) *gomarkov.Chain {
-	var chain *gomarkov.Chain
-	if existingChain != nil {
-		chain = existingChain
-	} else {
-		chain = gomarkov.NewChain(autoOrder(data, maxOrder, minSamplesPerState))
-	}
-	for _, sentence := range strings.Split(data, ".") {
-		sentence = strings.TrimSpace(sentence)
-		if sentence == "" {
+// MarkovModels The models templates generate text from
+var MarkovModels = NewModelRegistry(ModelsDir)
+
+// modelNamePattern Model names double as file names, so they are kept to a safe set of characters
+var modelNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ModelName Normalises a model name as written in a template or API call, which may carry the .json extension, and
+// checks that it is valid
+func ModelName(name string) (string, error) {
+	name = strings.TrimSuffix(name, ".json")
+	if !modelNamePattern.MatchString(name) {
+		return name, fmt.Errorf("invalid model name %q, use up to 64 letters, digits, - and _", name)
+	}
+	return name, nil
+}
+
+// ModelRegistry Named Markov models and the directory they are saved in. The models are copy-on-write: a published
+// chain is never changed, so pages read them without locking while training works on a copy and swaps it in.
+type ModelRegistry struct {
+	dir    string
+	models atomic.Pointer[map[string]*gomarkov.Chain]
+	// writeMu Serialises changes, so two trainings of one model don't drop each other's data
+	writeMu sync.Mutex
+}
+
+// NewModelRegistry Returns an empty registry saving to dir
+func NewModelRegistry(dir string) *ModelRegistry {
+	mr := &ModelRegistry{dir: dir}
+	mr.models.Store(&map[string]*gomarkov.Chain{})
+	return mr
+}
+
+// Dir Returns the directory the models are saved in
+func (mr *ModelRegistry) Dir() string {
+	return mr.dir
+}
+
+// path Returns the file a model is saved in
+func (mr *ModelRegistry) path(name string) string {
+	return filepath.Join(mr.dir, name+".json")
+}
+
+// update Publishes a copy of the models with change applied. Callers hold writeMu.
+func (mr *ModelRegistry) update(change func(models map[string]*gomarkov.Chain)) {
+	current := *mr.models.Load()
+	models := make(map[string]*gomarkov.Chain, len(current)+1)
+	for name, chain := range current {
+		models[name] = chain
+	}
+	change(models)
+	mr.models.Store(&models)
+}
+
+// Load Loads every model in the directory, replacing those already loaded, plus a legacy model.json
+func (mr *ModelRegistry) Load() error {
+	models := make(map[string]*gomarkov.Chain)
+	files, err := os.ReadDir(mr.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		name, err := ModelName(file.Name())
+		if err != nil {
+			log.Printf("Skipping model %s: %s\n", file.Name(), err)
 			continue
 		}
-		chain.Add(strings.Fields(sentence))
+		chain, err := loadChain(filepath.Join(mr.dir, file.Name()))
+		if err != nil {
+			return fmt.Errorf("loading model %s: %w", file.Name(), err)
+		}
+		models[name] = chain
+	}
+	if _, ok := models[DefaultModel]; !ok && FileExists(legacyModelsFile) {
+		chain, err := loadChain(legacyModelsFile)
+		if err != nil {
+			return fmt.Errorf("loading model %s: %w", legacyModelsFile, err)
+		}
+		models[DefaultModel] = chain
 	}
-	return chain
+
+	mr.writeMu.Lock()
+	mr.models.Store(&models)
+	mr.writeMu.Unlock()
+	return nil
 }
 
-func SaveMarkovModel() {
-	jsonObj, _ := json.Marshal(MarkovModel)
-	err := os.WriteFile("model.json", jsonObj, 0644)
+// loadChain Reads a model saved by the registry
+func loadChain(path string) (*gomarkov.Chain, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
+	return decodeChain(data)
 }
 
-func LoadMarkovModel() (*gomarkov.Chain, error) {
+// decodeChain Decodes a model from its JSON
+func decodeChain(data []byte) (*gomarkov.Chain, error) {
 	var chain gomarkov.Chain
-	data, err := os.ReadFile("model.json")
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// cloneChain Returns a deep copy of chain. gomarkov keeps its tables private, so the copy goes through JSON.
+func cloneChain(chain *gomarkov.Chain) (*gomarkov.Chain, error) {
+	data, err := json.Marshal(chain)
 	if err != nil {
-		return &chain, err
+		return nil, err
 	}
-	err = json.Unmarshal(data, &chain)
+	return decodeChain(data)
+}
+
+// Get Returns the model called name, or nil if there is none. The chain must not be changed.
+func (mr *ModelRegistry) Get(name string) *gomarkov.Chain {
+	return (*mr.models.Load())[strings.TrimSuffix(name, ".json")]
+}
+
+// Names Returns the names of the loaded models in order
+func (mr *ModelRegistry) Names() []string {
+	models := *mr.models.Load()
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Train Trains a copy of the model called name on corpus, or a new model if there is none, saves it and then swaps it
+// in. Pages keep using the previous version until then, and keep it if the model can't be saved.
+func (mr *ModelRegistry) Train(name, corpus string) (*gomarkov.Chain, error) {
+	chain, _, err := mr.TrainFrom(name, func(trainer *CorpusTrainer) error {
+		trainer.AddDocument(corpus)
+		return nil
+	}, nil)
+	return chain, err
+}
+
+// TrainFrom Trains the model called name like Train, on whatever read feeds the trainer. progress, if not nil, is
+// called as tokens are learned. Nothing is saved if read fails or teaches the model nothing.
+func (mr *ModelRegistry) TrainFrom(name string, read func(*CorpusTrainer) error, progress func(CorpusStats)) (*gomarkov.Chain, CorpusStats, error) {
+	name, err := ModelName(name)
 	if err != nil {
-		return &chain, err
+		return nil, CorpusStats{}, err
 	}
-	MarkovModel = &chain
-	return &chain, nil
+	mr.writeMu.Lock()
+	defer mr.writeMu.Unlock()
+	var chain *gomarkov.Chain
+	if existing := mr.Get(name); existing != nil {
+		if chain, err = cloneChain(existing); err != nil {
+			return nil, CorpusStats{}, fmt.Errorf("copying model %s: %w", name, err)
+		}
+	}
+	trainer := NewCorpusTrainer(chain, progress)
+	if err := read(trainer); err != nil {
+		return nil, trainer.stats, err
+	}
+	chain, stats := trainer.Finish()
+	if stats.Tokens == 0 {
+		return nil, stats, errors.New("the corpus holds no sentences")
+	}
+	if err := mr.write(name, chain); err != nil {
+		return nil, stats, fmt.Errorf("saving model %s: %w", name, err)
+	}
+	if err := mr.addFingerprints(name, trainer.fingerprints); err != nil {
+		log.Printf("Error saving the fingerprints of model %s: %s\n", name, err)
+	}
+	mr.update(func(models map[string]*gomarkov.Chain) {
+		models[name] = chain
+	})
+	return chain, stats, nil
 }
 
-func getDataset(inputData string) []string {
-	reader := strings.NewReader(inputData)
-	scanner := bufio.NewScanner(reader)
-	var list []string
-	for scanner.Scan() {
-		list = append(list, scanner.Text())
+// Export Returns the model called name as saved on disk
+func (mr *ModelRegistry) Export(name string) ([]byte, error) {
+	chain := mr.Get(name)
+	if chain == nil {
+		return nil, fmt.Errorf("model %q does not exist", name)
 	}
-	return list
+	return json.Marshal(chain)
 }
 
-func split(str string) []string {
-	return strings.Fields(str) // Split into words
+// Save Writes the model called name to its file
+func (mr *ModelRegistry) Save(name string) error {
+	chain := mr.Get(name)
+	if chain == nil {
+		return fmt.Errorf("model %q does not exist", name)
+	}
+	return mr.write(strings.TrimSuffix(name, ".json"), chain)
+}
+
+// write Saves chain as the model called name. The file is replaced atomically, so a crash mid-save leaves the
+// previous version.
+func (mr *ModelRegistry) write(name string, chain *gomarkov.Chain) error {
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mr.dir, 0755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(mr.path(name), data, 0644)
+}
+
+// Delete Removes the model called name and its file
+func (mr *ModelRegistry) Delete(name string) error {
+	name, err := ModelName(name)
+	if err != nil {
+		return err
+	}
+	mr.writeMu.Lock()
+	defer mr.writeMu.Unlock()
+	if mr.Get(name) == nil {
+		return fmt.Errorf("model %q does not exist", name)
+	}
+	for _, path := range []string{mr.path(name), mr.fingerprintsPath(name)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if name == DefaultModel && FileExists(legacyModelsFile) {
+		if err := os.Remove(legacyModelsFile); err != nil {
+			return err
+		}
+	}
+	mr.update(func(models map[string]*gomarkov.Chain) {
+		delete(models, name)
+	})
+	return nil
 }
 
 func countNGrams(tokens []string, n int) map[string]int {
@@ -73,8 +268,9 @@ func countNGrams(tokens []string, n int) map[string]int {
 	return ngrams
 }
 
-func autoOrder(input string, maxOrder int, minSamplesPerState float64) int {
-	tokens := strings.Fields(input)
+// autoOrderTokens Picks the highest order up to maxOrder at which the states of tokens are seen minSamplesPerState
+// times on average
+func autoOrderTokens(tokens []string, maxOrder int, minSamplesPerState float64) int {
 	bestOrder := 1
 	for order := 1; order <= maxOrder; order++ {
 		ngrams := countNGrams(tokens, order)
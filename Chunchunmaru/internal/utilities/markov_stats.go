@@ -0,0 +1,197 @@
+package utilities
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mb-14/gomarkov"
+	"hash/fnv"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fingerprintsExtension Suffix of the file next to a model holding the fingerprints of the sentences it was trained on
+const fingerprintsExtension = ".fingerprints"
+
+// statsSentenceLength How many tokens a sentence generated for statistics may have
+const statsSentenceLength = 200
+
+// GenerateSentence Generates the tokens of a sentence of up to length tokens from chain using rng
+func GenerateSentence(chain *gomarkov.Chain, rng *rand.Rand, length int) []string {
+	tokens, _ := generateSentence(chain, rng, length)
+	return tokens
+}
+
+// generateSentence Generates a sentence like GenerateSentence, and reports whether the chain ended it rather than it
+// being cut off at length
+func generateSentence(chain *gomarkov.Chain, rng *rand.Rand, length int) ([]string, bool) {
+	order := chain.Order
+	tokens := make([]string, 0)
+	for i := 0; i < order; i++ {
+		tokens = append(tokens, gomarkov.StartToken)
+	}
+	for tokens[len(tokens)-1] != gomarkov.EndToken && len(tokens) < length {
+		next, _ := chain.GenerateDeterministic(tokens[(len(tokens)-order):], rng)
+		tokens = append(tokens, next)
+	}
+	complete := tokens[len(tokens)-1] == gomarkov.EndToken
+	if len(tokens)-1 < order {
+		return nil, complete
+	}
+	return tokens[order : len(tokens)-1], complete
+}
+
+// sentenceFingerprint Hashes a sentence's tokens, to tell whether a generated sentence appeared in the training data
+// without keeping the data
+func sentenceFingerprint(tokens []string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(strings.Join(tokens, " ")))
+	return hash.Sum64()
+}
+
+// fingerprintsPath Returns the file holding the fingerprints of the model called name
+func (mr *ModelRegistry) fingerprintsPath(name string) string {
+	return filepath.Join(mr.dir, name+fingerprintsExtension)
+}
+
+// addFingerprints Adds fingerprints to those saved for the model called name, keeping each fingerprint once so
+// retraining on the same corpus doesn't grow the file
+func (mr *ModelRegistry) addFingerprints(name string, fingerprints []uint64) error {
+	saved, err := mr.loadFingerprints(name)
+	if err != nil {
+		return err
+	}
+	if saved == nil {
+		saved = make(map[uint64]bool, len(fingerprints))
+	}
+	for _, fingerprint := range fingerprints {
+		saved[fingerprint] = true
+	}
+	data := make([]byte, 0, 8*len(saved))
+	for _, fingerprint := range slices.Sorted(maps.Keys(saved)) {
+		data = binary.LittleEndian.AppendUint64(data, fingerprint)
+	}
+	return WriteFileAtomic(mr.fingerprintsPath(name), data, 0644)
+}
+
+// loadFingerprints Reads the fingerprints saved for the model called name, or nil if there are none
+func (mr *ModelRegistry) loadFingerprints(name string) (map[uint64]bool, error) {
+	data, err := os.ReadFile(mr.fingerprintsPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	fingerprints := make(map[uint64]bool, len(data)/8)
+	for ; len(data) >= 8; data = data[8:] {
+		fingerprints[binary.LittleEndian.Uint64(data)] = true
+	}
+	return fingerprints, nil
+}
+
+// ModelStats What a Markov model has learned and how its output compares to its training data
+type ModelStats struct {
+	Name string `json:"name"`
+	// Order How many tokens the model looks back, as picked by autoOrder when it was created
+	Order int `json:"order"`
+	// States The distinct runs of Order tokens the model has seen
+	States int `json:"states"`
+	// Transitions The distinct state and next token pairs, and Observations how often they were seen in all
+	Transitions  int `json:"transitions"`
+	Observations int `json:"observations"`
+	// Vocabulary The distinct tokens the model can generate
+	Vocabulary int   `json:"vocabulary"`
+	FileSize   int64 `json:"fileSize"`
+	// TrainingSentences How many distinct sentences the model was trained on since fingerprints were kept
+	TrainingSentences int      `json:"trainingSentences"`
+	Samples           []string `json:"samples"`
+	// VerbatimRate The share of generated sentences that are copies of a training sentence, or nil if the model has
+	// no fingerprints to check against or generated no complete sentence
+	VerbatimRate *float64 `json:"verbatimRate"`
+	// Trials How many complete sentences were generated to measure VerbatimRate; those cut off at the length limit
+	// aren't counted
+	Trials int `json:"trials"`
+}
+
+// chainTables The tables gomarkov keeps private, as found in its JSON
+type chainTables struct {
+	SpoolMap map[string]int      `json:"spool_map"`
+	FreqMat  map[int]map[int]int `json:"freq_mat"`
+}
+
+// Stats Describes the model called name, with samples generated sentences, and measures how many of trials generated
+// sentences copy a training sentence verbatim
+func (mr *ModelRegistry) Stats(name string, samples, trials int, rng *rand.Rand) (ModelStats, error) {
+	name = strings.TrimSuffix(name, ".json")
+	stats := ModelStats{Name: name, Samples: make([]string, 0, samples)}
+	chain := mr.Get(name)
+	if chain == nil {
+		return stats, fmt.Errorf("model %q does not exist", name)
+	}
+
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return stats, err
+	}
+	var tables chainTables
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return stats, err
+	}
+	index := make(map[int]string, len(tables.SpoolMap))
+	for token, i := range tables.SpoolMap {
+		index[i] = token
+	}
+	vocabulary := make(map[int]bool)
+	stats.Order = chain.Order
+	stats.States = len(tables.FreqMat)
+	for _, row := range tables.FreqMat {
+		stats.Transitions += len(row)
+		for next, count := range row {
+			stats.Observations += count
+			if index[next] != gomarkov.EndToken {
+				vocabulary[next] = true
+			}
+		}
+	}
+	stats.Vocabulary = len(vocabulary)
+	if info, err := os.Stat(mr.path(name)); err == nil {
+		stats.FileSize = info.Size()
+	}
+
+	for i := 0; i < samples; i++ {
+		if tokens := GenerateSentence(chain, rng, statsSentenceLength); len(tokens) > 0 {
+			stats.Samples = append(stats.Samples, strings.Join(tokens, " ")+".")
+		}
+	}
+	fingerprints, err := mr.loadFingerprints(name)
+	if err != nil {
+		return stats, err
+	}
+	stats.TrainingSentences = len(fingerprints)
+	if len(fingerprints) == 0 || trials <= 0 {
+		return stats, nil
+	}
+	// Sentences cut off at statsSentenceLength can't match a training sentence, so only those the chain ended count
+	copies, complete := 0, 0
+	for i := 0; i < trials; i++ {
+		tokens, ended := generateSentence(chain, rng, statsSentenceLength)
+		if !ended {
+			continue
+		}
+		complete++
+		if fingerprints[sentenceFingerprint(tokens)] {
+			copies++
+		}
+	}
+	stats.Trials = complete
+	if complete > 0 {
+		rate := float64(copies) / float64(complete)
+		stats.VerbatimRate = &rate
+	}
+	return stats, nil
+}
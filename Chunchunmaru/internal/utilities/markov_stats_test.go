@@ -0,0 +1,69 @@
+package utilities
+
+import (
+	"fmt"
+	"github.com/mb-14/gomarkov"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestModelStats(t *testing.T) {
+	t.Chdir(t.TempDir())
+	registry := NewModelRegistry(ModelsDir)
+	if _, err := registry.Train("pets", "The cat sat. The dog sat."); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := registry.Stats("pets", 3, 100, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ^ -> The -> cat|dog -> sat -> $, at order 1
+	if stats.Order != 1 || stats.States != 5 || stats.Transitions != 6 || stats.Observations != 8 || stats.Vocabulary != 4 || stats.FileSize == 0 {
+		t.Fatalf("unexpected model shape %+v", stats)
+	}
+	if len(stats.Samples) != 3 || stats.TrainingSentences != 2 || stats.VerbatimRate == nil || *stats.VerbatimRate != 1 || stats.Trials != 100 {
+		t.Fatalf("every sentence this model can say is a training sentence, got %+v", stats)
+	}
+
+	// Retraining on the same corpus adds no fingerprints
+	if _, err := registry.Train("pets", "The cat sat. The dog sat."); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(registry.fingerprintsPath("pets")); err != nil || info.Size() != 16 {
+		t.Fatalf("expected 2 fingerprints on disk, got %v %v", info, err)
+	}
+
+	// A model trained on one long sentence and one that branches can say things it never read
+	if _, err := registry.Train("pets", "The cat sat on the mat today. The dog sat on the log yesterday."); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ = registry.Stats("pets", 0, 1000, rand.New(rand.NewSource(1)))
+	if stats.TrainingSentences != 4 || *stats.VerbatimRate == 1 || *stats.VerbatimRate == 0 {
+		t.Fatalf("expected some but not all sentences to be copies, got %+v", stats)
+	}
+
+	// Sentences cut off at the length limit can't be copies, so they aren't counted
+	words := make([]string, statsSentenceLength+50)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	if _, err := registry.Train("endless", strings.Join(words, " ")+"."); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := registry.Stats("endless", 0, 10, rand.New(rand.NewSource(1))); err != nil || stats.VerbatimRate != nil || stats.Trials != 0 {
+		t.Fatalf("expected no complete sentences to measure, got %+v %v", stats, err)
+	}
+
+	// Models trained before fingerprints were kept can't be checked
+	registry.update(func(models map[string]*gomarkov.Chain) {
+		models["legacy"] = trainChain("Old words were here.")
+	})
+	if stats, err := registry.Stats("legacy", 1, 100, rand.New(rand.NewSource(1))); err != nil || stats.VerbatimRate != nil {
+		t.Fatalf("expected an unknown verbatim rate, got %+v %v", stats, err)
+	}
+	if _, err := registry.Stats("missing", 1, 1, rand.New(rand.NewSource(1))); err == nil {
+		t.Fatal("expected a missing model to fail")
+	}
+}
@@ -1,8 +1,11 @@
 package utilities
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/mb-14/gomarkov"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -16,8 +19,16 @@ func printTestResults(name, result interface{}) {
 	fmt.Printf("--------------------------\n")
 }
 
+// trainChain Returns a new chain trained on text
+func trainChain(text string) *gomarkov.Chain {
+	trainer := NewCorpusTrainer(nil, nil)
+	trainer.AddDocument(text)
+	chain, _ := trainer.Finish()
+	return chain
+}
+
 func BenchmarkChainGenerate(b *testing.B) {
-	chain := TrainMarkovModel(dataset, 5, 2.0, nil)
+	chain := trainChain(dataset)
 	order := chain.Order
 	tokens := make([]string, 0)
 	for i := 0; i < order; i++ {
@@ -29,3 +40,87 @@ func BenchmarkChainGenerate(b *testing.B) {
 	}
 	printTestResults("Train & Test Markov Chain", strings.Join(tokens[order:len(tokens)-1], " "))
 }
+
+func TestModelRegistry(t *testing.T) {
+	t.Chdir(t.TempDir())
+	registry := NewModelRegistry(ModelsDir)
+	if _, err := registry.Train("../escape", dataset); err == nil {
+		t.Fatal("expected an invalid name to be rejected")
+	}
+	if _, err := registry.Train("forum.json", dataset); err != nil {
+		t.Fatal(err)
+	}
+	legacy, _ := json.Marshal(trainChain("Old words were here. Old words stay."))
+	if err := os.WriteFile(legacyModelsFile, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewModelRegistry(ModelsDir)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if names := loaded.Names(); strings.Join(names, ",") != "forum,model" {
+		t.Fatalf("expected the trained and the legacy model, got %v", names)
+	}
+	if loaded.Get("forum").Order != registry.Get("forum").Order {
+		t.Fatal("the saved model doesn't match the trained one")
+	}
+
+	if err := loaded.Delete(DefaultModel); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Delete("missing"); err == nil {
+		t.Fatal("expected deleting a missing model to fail")
+	}
+	if err := loaded.Load(); err != nil || strings.Join(loaded.Names(), ",") != "forum" {
+		t.Fatalf("expected the deleted model to stay gone, got %v %v", loaded.Names(), err)
+	}
+}
+
+func TestModelRegistryTrainCopyOnWrite(t *testing.T) {
+	dir := t.TempDir()
+	registry := NewModelRegistry(dir)
+	before, err := registry.Train("forum", dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe := make([]string, before.Order)
+	for i := range probe {
+		probe[i] = gomarkov.StartToken
+	}
+
+	// Pages generating from the model while it is retrained
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			registry.Get("forum").Generate(probe)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		if _, err := registry.Train("forum", "Zebras graze quietly at dawn."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if probability, _ := before.TransitionProbability("Zebras", probe); probability != 0 {
+		t.Fatal("training changed the published chain")
+	}
+	if probability, _ := registry.Get("forum").TransitionProbability("Zebras", probe); probability == 0 {
+		t.Fatal("the trained chain was not swapped in")
+	}
+
+	// A model that can't be saved is reported and not swapped in
+	current := registry.Get("forum")
+	blocked := NewModelRegistry(filepath.Join(dir, "forum.json"))
+	blocked.update(func(models map[string]*gomarkov.Chain) { models["forum"] = current })
+	if _, err := blocked.Train("forum", "Nothing is saved here."); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+	if blocked.Get("forum") != current {
+		t.Fatal("a model that failed to save was swapped in")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(matches) != 0 {
+		t.Fatalf("temporary files were left behind: %v", matches)
+	}
+}
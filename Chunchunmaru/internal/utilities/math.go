@@ -1,6 +1,7 @@
 package utilities
 
 import (
+	"math"
 	"math/rand"
 	"time"
 )
@@ -20,3 +21,23 @@ func RandomDuration(min, max time.Duration) time.Duration {
 	// rand.Int63n returns [0, delta)
 	return min + time.Duration(rand.Int63n(int64(delta)+1))
 }
+
+// ClampInt Restricts value to the range [min, max]
+func ClampInt(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// DecayRate Decays an exponentially weighted request rate last updated at last so that it halves every halfLife.
+// A non-positive halfLife disables decay.
+func DecayRate(rate float64, last, now time.Time, halfLife time.Duration) float64 {
+	if halfLife > 0 && !last.IsZero() && now.After(last) {
+		rate *= math.Exp2(-float64(now.Sub(last)) / float64(halfLife))
+	}
+	return rate
+}
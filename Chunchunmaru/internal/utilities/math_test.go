@@ -1,9 +1,24 @@
 package utilities
 
 import (
+	"math"
 	"testing"
+	"time"
 )
 
 func BenchmarkRandomNumber(b *testing.B) {
 	printTestResults("Random Number", RandomNumber(0, 100))
 }
+
+func TestDecayRate(t *testing.T) {
+	now := time.Now()
+	if rate := DecayRate(10, now.Add(-time.Hour), now, time.Hour); math.Abs(rate-5) > 1e-9 {
+		t.Fatalf("expected rate 5 after one half-life, got %f", rate)
+	}
+	if rate := DecayRate(10, now.Add(-time.Hour), now, 0); rate != 10 {
+		t.Fatalf("expected undecayed rate 10, got %f", rate)
+	}
+	if rate := DecayRate(10, time.Time{}, now, time.Hour); rate != 10 {
+		t.Fatalf("expected rate without a last hit to stay 10, got %f", rate)
+	}
+}
@@ -0,0 +1,183 @@
+package utilities
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationName Matches migration file names such as 0002_client_history.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// addColumnStatement Matches ALTER TABLE ... ADD COLUMN statements, capturing the table and column
+var addColumnStatement = regexp.MustCompile("(?is)^ALTER\\s+TABLE\\s+`?(\\w+)`?\\s+ADD\\s+(?:COLUMN\\s+)?`?(\\w+)`?")
+
+// Migration One step of the database schema, read from the embedded migrations directory.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations Returns every embedded migration, ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: match[2], SQL: string(content)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion Returns the version of the last migration applied to db, or 0 if none has been. It only reads, so it
+// works on a database opened with OpenDatabaseReadOnly.
+func SchemaVersion(db *sql.DB) (int, error) {
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM `schema_version`").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// PendingMigrations Returns the migrations that have not been applied to db yet.
+func PendingMigrations(db *sql.DB) ([]Migration, error) {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	pending := migrations[:0]
+	for _, migration := range migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate Applies every pending migration to db in a single transaction, so a failed migration leaves the database as
+// it was. Returns the migrations that were applied.
+func Migrate(db *sql.DB) ([]Migration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS `schema_version` (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at INTEGER NOT NULL)"); err != nil {
+		return nil, err
+	}
+	for _, migration := range pending {
+		if err := applyMigration(tx, migration); err != nil {
+			return nil, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO `schema_version` (version, name, applied_at) VALUES (?, ?, ?)",
+			migration.Version, migration.Name, time.Now().Unix()); err != nil {
+			return nil, err
+		}
+		log.Printf("Applied database migration %04d_%s\n", migration.Version, migration.Name)
+	}
+	return pending, tx.Commit()
+}
+
+// applyMigration Runs each statement of migration. Columns added by builds that predate schema versioning are skipped
+// rather than added twice.
+func applyMigration(tx *sql.Tx, migration Migration) error {
+	for _, statement := range splitStatements(migration.SQL) {
+		if match := addColumnStatement.FindStringSubmatch(statement); match != nil {
+			exists, err := columnExists(tx, match[1], match[2])
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+		}
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements Splits a migration into its statements, dropping comment lines.
+func splitStatements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	var statements []string
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// columnExists Reports whether table has a column called column
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(`%s`)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(name, column) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
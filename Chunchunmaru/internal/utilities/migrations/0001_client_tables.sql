@@ -0,0 +1,3 @@
+-- The tables the first release created from main()
+CREATE TABLE IF NOT EXISTS `ipinfo` (ip TEXT PRIMARY KEY, queries INTEGER, aggression INTEGER);
+CREATE TABLE IF NOT EXISTS `agentinfo` (useragent TEXT PRIMARY KEY, queries INTEGER, aggression INTEGER);
@@ -0,0 +1,17 @@
+-- Decaying request rate and the behaviour the scorers look at
+ALTER TABLE `ipinfo` ADD COLUMN rate REAL NOT NULL DEFAULT 0;
+ALTER TABLE `ipinfo` ADD COLUMN last_seen INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `ipinfo` ADD COLUMN interval_mean REAL NOT NULL DEFAULT 0;
+ALTER TABLE `ipinfo` ADD COLUMN interval_var REAL NOT NULL DEFAULT 0;
+ALTER TABLE `ipinfo` ADD COLUMN cookie_misses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `ipinfo` ADD COLUMN honeypot_hits INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `agentinfo` ADD COLUMN rate REAL NOT NULL DEFAULT 0;
+ALTER TABLE `agentinfo` ADD COLUMN last_seen INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `agentinfo` ADD COLUMN interval_mean REAL NOT NULL DEFAULT 0;
+ALTER TABLE `agentinfo` ADD COLUMN interval_var REAL NOT NULL DEFAULT 0;
+ALTER TABLE `agentinfo` ADD COLUMN cookie_misses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `agentinfo` ADD COLUMN honeypot_hits INTEGER NOT NULL DEFAULT 0;
+-- Rows from before last_seen was tracked would otherwise look as if they were last seen in 1970 and be pruned at once,
+-- so they count as seen when the column is added
+UPDATE `ipinfo` SET last_seen = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000 WHERE last_seen = 0;
+UPDATE `agentinfo` SET last_seen = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000 WHERE last_seen = 0;
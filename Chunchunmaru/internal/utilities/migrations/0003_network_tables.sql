@@ -0,0 +1,23 @@
+-- Reputation aggregated by subnet and autonomous system
+CREATE TABLE IF NOT EXISTS `subnetinfo` (
+    subnet TEXT PRIMARY KEY,
+    queries INTEGER,
+    aggression INTEGER,
+    rate REAL NOT NULL DEFAULT 0,
+    last_seen INTEGER NOT NULL DEFAULT 0,
+    interval_mean REAL NOT NULL DEFAULT 0,
+    interval_var REAL NOT NULL DEFAULT 0,
+    cookie_misses INTEGER NOT NULL DEFAULT 0,
+    honeypot_hits INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS `asninfo` (
+    asn TEXT PRIMARY KEY,
+    queries INTEGER,
+    aggression INTEGER,
+    rate REAL NOT NULL DEFAULT 0,
+    last_seen INTEGER NOT NULL DEFAULT 0,
+    interval_mean REAL NOT NULL DEFAULT 0,
+    interval_var REAL NOT NULL DEFAULT 0,
+    cookie_misses INTEGER NOT NULL DEFAULT 0,
+    honeypot_hits INTEGER NOT NULL DEFAULT 0
+);
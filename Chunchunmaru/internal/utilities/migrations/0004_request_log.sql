@@ -0,0 +1,16 @@
+-- Append-only log of every request the tarpit served
+CREATE TABLE IF NOT EXISTS `requests` (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    time INTEGER NOT NULL,
+    ip TEXT NOT NULL,
+    useragent TEXT NOT NULL,
+    path TEXT NOT NULL,
+    query TEXT NOT NULL,
+    template TEXT NOT NULL,
+    aggression INTEGER NOT NULL,
+    delay INTEGER NOT NULL,
+    bytes INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `requests_time` ON `requests` (time);
+CREATE INDEX IF NOT EXISTS `requests_ip` ON `requests` (ip, time);
+CREATE INDEX IF NOT EXISTS `requests_useragent` ON `requests` (useragent, time);
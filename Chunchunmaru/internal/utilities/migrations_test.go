@@ -0,0 +1,105 @@
+package utilities
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	applied, err := Migrate(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got %d", len(migrations), len(applied))
+	}
+	if applied, err = Migrate(db); err != nil || len(applied) != 0 {
+		t.Fatalf("expected nothing to apply a second time, got %d, %v", len(applied), err)
+	}
+	if version, _ := SchemaVersion(db); version != latest {
+		t.Fatalf("expected schema version %d, got %d", latest, version)
+	}
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// A database from before schema versioning, which had already gained some of the history columns
+	for _, statement := range []string{
+		"CREATE TABLE ipinfo (ip TEXT PRIMARY KEY, queries INTEGER, aggression INTEGER, rate REAL NOT NULL DEFAULT 0)",
+		"CREATE TABLE agentinfo (useragent TEXT PRIMARY KEY, queries INTEGER, aggression INTEGER)",
+		"INSERT INTO ipinfo (ip, queries, aggression, rate) VALUES ('203.0.113.7', 12, 0, 3.5)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := time.Now().Add(-time.Second)
+	if _, err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	var queries int
+	var rate float64
+	var lastSeen int64
+	if err := db.QueryRow("SELECT queries, rate, last_seen FROM ipinfo WHERE ip = '203.0.113.7'").Scan(&queries, &rate, &lastSeen); err != nil {
+		t.Fatal(err)
+	}
+	if queries != 12 || rate != 3.5 {
+		t.Fatalf("existing row was not preserved: %d, %v", queries, rate)
+	}
+	// Rows without a last_seen count as seen at the migration, so pruning doesn't drop them all at once
+	if seen := time.Unix(0, lastSeen); seen.Before(before) || seen.After(time.Now()) {
+		t.Fatalf("expected last_seen to be backfilled with the migration time, got %v", seen)
+	}
+}
+
+func TestSchemaVersionReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fresh.db")
+	if _, err := OpenDatabaseReadOnly(path); err == nil {
+		t.Fatal("expected a missing database not to be created")
+	}
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE ipinfo (ip TEXT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	readOnly, err := OpenDatabaseReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	if version, err := SchemaVersion(readOnly); err != nil || version != 0 {
+		t.Fatalf("expected version 0 of an unversioned database, got %d, %v", version, err)
+	}
+	if pending, err := PendingMigrations(readOnly); err != nil || len(pending) == 0 {
+		t.Fatalf("expected pending migrations, got %d, %v", len(pending), err)
+	}
+	var tables int
+	readOnly.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_version'").Scan(&tables)
+	if tables != 0 {
+		t.Fatal("reading the schema version created its table")
+	}
+	if _, err := readOnly.Exec("CREATE TABLE scratch (id INTEGER)"); err == nil {
+		t.Fatal("expected a read-only database to refuse changes")
+	}
+}
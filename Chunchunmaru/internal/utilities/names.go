@@ -0,0 +1,151 @@
+package utilities
+
+import (
+	"embed"
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// nameSeeds Lists of real looking names the character models are trained on, one per line
+//
+//go:embed names/*.txt
+var nameSeeds embed.FS
+
+// nameModels The character models behind the name generators, built on first use
+var nameModels = sync.OnceValue(func() map[string]*CharModel {
+	// Short lists need a short memory to come up with anything new, codes a shorter one to mix their parts
+	orders := map[string]int{"usernames": 3, "surnames": 3, "companies": 2, "domains": 2, "products": 1}
+	models := make(map[string]*CharModel, len(orders))
+	for name, order := range orders {
+		seeds, err := nameSeeds.ReadFile("names/" + name + ".txt")
+		if err != nil {
+			panic(err)
+		}
+		models[name] = NewCharModel(order, strings.Split(string(seeds), "\n"))
+	}
+	return models
+})
+
+// Parts names are put together from
+var (
+	companySuffixes = []string{"Inc", "LLC", "Ltd", "Group", "Labs", "Systems", "Solutions", "Partners", "Holdings", "Technologies", "& Co"}
+	domainSuffixes  = []string{".com", ".com", ".com", ".com", ".net", ".org", ".io", ".co", ".dev", ".app", ".info", ".biz"}
+	usernameJoiners = []string{"", "_", ".", "-"}
+)
+
+// randomDigits Returns a plausible number to tack onto a name, like a year or a short count
+func randomDigits(r *rand.Rand) string {
+	if r.Intn(3) == 0 {
+		return fmt.Sprintf("%d", 1960+r.Intn(50))
+	}
+	return fmt.Sprintf("%d", r.Intn(1000))
+}
+
+// randomInitial Returns a random lowercase letter
+func randomInitial(r *rand.Rand) string {
+	return string(LowerAlphabetChars[r.Intn(len(LowerAlphabetChars))])
+}
+
+// capitalize Upper-cases the first letter of word
+func capitalize(word string) string {
+	for i, r := range word {
+		return string(unicode.ToUpper(r)) + word[i+len(string(r)):]
+	}
+	return word
+}
+
+// RandomSurname Makes up a surname of up to maxLength characters, or any length if maxLength isn't positive
+func RandomSurname(r *rand.Rand, maxLength int) string {
+	return capitalize(nameModels()["surnames"].Generate(r, maxLength))
+}
+
+// RandomUsername Makes up a username of up to maxLength characters, or any length if maxLength isn't positive. Most
+// are made up outright, the rest mix in dictionary words, surnames and numbers the way people do.
+func RandomUsername(r *rand.Rand, maxLength int) string {
+	models := nameModels()
+	var username string
+	switch r.Intn(6) {
+	case 0:
+		username = models["usernames"].Generate(r, 0) + randomDigits(r)
+	case 1:
+		username = strings.ToLower(CleanString(RandomWord(r))) + usernameJoiners[r.Intn(len(usernameJoiners))] + models["usernames"].Generate(r, 0)
+	case 2:
+		username = randomInitial(r) + strings.ToLower(models["surnames"].Generate(r, 0))
+		if r.Intn(2) == 0 {
+			username += randomDigits(r)
+		}
+	default:
+		username = models["usernames"].Generate(r, maxLength)
+	}
+	if maxLength > 0 && len(username) > maxLength {
+		return models["usernames"].Generate(r, maxLength)
+	}
+	return username
+}
+
+// RandomCompany Makes up a company name, sometimes with a legal suffix or as a partnership of two surnames
+func RandomCompany(r *rand.Rand) string {
+	models := nameModels()
+	switch r.Intn(5) {
+	case 0:
+		return RandomSurname(r, 0) + " & " + RandomSurname(r, 0)
+	case 1, 2:
+		return capitalize(models["companies"].Generate(r, 0)) + " " + companySuffixes[r.Intn(len(companySuffixes))]
+	default:
+		return capitalize(models["companies"].Generate(r, 0))
+	}
+}
+
+// RandomDomain Makes up a domain name, mostly .com
+func RandomDomain(r *rand.Rand) string {
+	stem := strings.ToLower(nameModels()["domains"].Generate(r, 0))
+	if r.Intn(4) == 0 {
+		stem += strings.ToLower(nameModels()["companies"].Generate(r, 8))
+	}
+	return stem + domainSuffixes[r.Intn(len(domainSuffixes))]
+}
+
+// RandomProductCode Makes up a product code in the style of model numbers such as XR-450
+func RandomProductCode(r *rand.Rand) string {
+	return nameModels()["products"].Generate(r, 0)
+}
+
+// RandomEmail Makes up an email address at a domain picked from domains by weight, where "*" stands for a made up
+// domain. Without any weights, the domain is made up.
+func RandomEmail(r *rand.Rand, domains map[string]float64) string {
+	var local string
+	switch r.Intn(4) {
+	case 0:
+		local = strings.ToLower(CleanString(RandomWord(r)) + "." + RandomSurname(r, 0))
+	case 1:
+		local = randomInitial(r) + strings.ToLower(RandomSurname(r, 0)) + randomDigits(r)
+	default:
+		local = strings.ToLower(RandomUsername(r, 0))
+	}
+	return local + "@" + pickEmailDomain(r, domains)
+}
+
+// pickEmailDomain Picks a domain from domains by weight, in a fixed order so the same random source picks the same one
+func pickEmailDomain(r *rand.Rand, domains map[string]float64) string {
+	var total float64
+	for _, weight := range domains {
+		total += max(weight, 0)
+	}
+	if total > 0 {
+		n := r.Float64() * total
+		for _, domain := range slices.Sorted(maps.Keys(domains)) {
+			if n -= max(domains[domain], 0); n < 0 {
+				if domain == "*" {
+					break
+				}
+				return domain
+			}
+		}
+	}
+	return RandomDomain(r)
+}
@@ -0,0 +1,91 @@
+package utilities
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCharModel(t *testing.T) {
+	model := NewCharModel(1, []string{"anna", "anne", "hanna", "hannah", "nan"})
+	first := rand.New(rand.NewSource(3))
+	second := rand.New(rand.NewSource(3))
+	for i := 0; i < 50; i++ {
+		word := model.Generate(first, 0)
+		if again := model.Generate(second, 0); again != word {
+			t.Fatalf("expected the same source to make the same word, got %q and %q", word, again)
+		}
+		if len(word) > 6 || strings.Trim(word, "aehn") != "" {
+			t.Fatalf("expected a word of up to 6 of the training letters, got %q", word)
+		}
+		if short := model.Generate(rand.New(rand.NewSource(int64(i))), 3); len(short) > 3 {
+			t.Fatalf("expected at most 3 characters, got %q", short)
+		}
+	}
+
+	// With nothing new to say, a model still says something
+	if word := NewCharModel(2, []string{"solo"}).Generate(first, 0); word != "solo" {
+		t.Fatalf("expected the only word the model knows, got %q", word)
+	}
+}
+
+func TestNameGenerators(t *testing.T) {
+	seeds := make(map[string]bool)
+	for _, list := range []string{"usernames", "surnames"} {
+		data, _ := nameSeeds.ReadFile("names/" + list + ".txt")
+		for _, seed := range strings.Fields(string(data)) {
+			seeds[strings.ToLower(seed)] = true
+		}
+	}
+	domain := regexp.MustCompile(`^[a-z0-9-]+\.[a-z]+$`)
+	product := regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+	r := rand.New(rand.NewSource(1))
+	copies := 0
+	for i := 0; i < 200; i++ {
+		surname := RandomSurname(r, 0)
+		if seeds[strings.ToLower(surname)] {
+			copies++
+		}
+		if username := RandomUsername(r, 8); username == "" || len(username) > 8 {
+			t.Fatalf("expected a username of up to 8 characters, got %q", username)
+		}
+		if name := RandomDomain(r); !domain.MatchString(name) {
+			t.Fatalf("expected a domain name, got %q", name)
+		}
+		if code := RandomProductCode(r); !product.MatchString(code) {
+			t.Fatalf("expected a product code, got %q", code)
+		}
+		if RandomCompany(r) == "" {
+			t.Fatal("expected a company name")
+		}
+	}
+	if copies > 0 {
+		t.Fatalf("expected made up surnames, got %d copies of seed names", copies)
+	}
+}
+
+func TestRandomEmail(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		if email := RandomEmail(r, map[string]float64{"example.org": 1, "example.com": 0}); !strings.HasSuffix(email, "@example.org") {
+			t.Fatalf("expected an address at the only weighted domain, got %q", email)
+		}
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		email := RandomEmail(r, map[string]float64{"example.org": 3, "*": 1})
+		local, domain, _ := strings.Cut(email, "@")
+		if local == "" || strings.ContainsAny(local, " @") {
+			t.Fatalf("expected a plausible local part, got %q", email)
+		}
+		if domain != "example.org" {
+			domain = "*"
+		}
+		counts[domain]++
+	}
+	if counts["example.org"] < 1350 || counts["example.org"] > 1650 {
+		t.Fatalf("expected about 3 in 4 addresses at example.org, got %v", counts)
+	}
+}
@@ -0,0 +1,39 @@
+package utilities
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+// RequestSeed Derives a stable seed for a request from the server secret and the request path (plus the raw query
+// when includeQuery is set), so the same fake URL always renders the same page.
+func RequestSeed(secret string, r *http.Request, includeQuery bool) int64 {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.URL.Path))
+	if includeQuery && r.URL.RawQuery != "" {
+		mac.Write([]byte{'?'})
+		mac.Write([]byte(r.URL.RawQuery))
+	}
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)[:8]))
+}
+
+// EnsureSecret Generates a random seed secret if the config does not have one. Pages are then only stable until the
+// next restart, so a fixed secret should be configured for production.
+func EnsureSecret(cm *ConfigManager) {
+	config := cm.GetConfig()
+	if config.Secret != "" {
+		return
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal(err)
+	}
+	config.Secret = hex.EncodeToString(secret)
+	cm.SetConfig(config)
+	log.Println("No secret configured, generated a temporary one. Pages will change on restart.")
+}
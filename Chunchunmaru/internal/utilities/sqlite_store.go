@@ -0,0 +1,378 @@
+package utilities
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// historyColumns Columns that track a client's behaviour over time, shared by every client table
+var historyColumns = []string{"rate", "last_seen", "interval_mean", "interval_var", "cookie_misses", "honeypot_hits"}
+
+// clientTableNames The table each kind of client is stored in. Each table is keyed by a column named after the kind.
+var clientTableNames = map[ClientKind]string{
+	ClientIP:        "ipinfo",
+	ClientUserAgent: "agentinfo",
+	ClientSubnet:    "subnetinfo",
+	ClientASN:       "asninfo",
+}
+
+// clientTable Returns the table clients of kind are stored in
+func clientTable(kind ClientKind) SqlTable {
+	columns := append([]string{string(kind), "queries", "aggression"}, historyColumns...)
+	return SqlTable{Name: clientTableNames[kind], Columns: columns}
+}
+
+// clientStatements The prepared statements for one client table
+type clientStatements struct {
+	get    *sql.Stmt
+	upsert *sql.Stmt
+	list   *sql.Stmt
+	delete *sql.Stmt
+	wipe   *sql.Stmt
+	prune  *sql.Stmt
+}
+
+// SQLiteStore A ClientStore backed by a SQLite database.
+type SQLiteStore struct {
+	db            *sql.DB
+	statements    map[ClientKind]*clientStatements
+	logRequest    *sql.Stmt
+	pruneRequests *sql.Stmt
+	capRequests   *sql.Stmt
+}
+
+// OpenSQLiteStore Opens or creates the SQLite database at path, applies any pending migrations and prepares it for
+// recording clients.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := OpenDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer, so hand connections out one at a time rather than fail with "database is locked"
+	db.SetMaxOpenConns(1)
+	if _, err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store := &SQLiteStore{db: db, statements: make(map[ClientKind]*clientStatements, len(ClientKinds))}
+	for _, kind := range ClientKinds {
+		if err := store.prepare(kind); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := store.prepareRequestLog(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// prepareRequestLog Prepares the statements for the requests table.
+func (s *SQLiteStore) prepareRequestLog() error {
+	var err error
+	if s.logRequest, err = s.db.Prepare("INSERT INTO `requests` (time, ip, useragent, path, query, template, aggression, delay, bytes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"); err != nil {
+		return err
+	}
+	if s.pruneRequests, err = s.db.Prepare("DELETE FROM `requests` WHERE time < ?"); err != nil {
+		return err
+	}
+	// Deletes everything but the newest ? rows
+	s.capRequests, err = s.db.Prepare("DELETE FROM `requests` WHERE id <= (SELECT id FROM `requests` ORDER BY id DESC LIMIT 1 OFFSET ?)")
+	return err
+}
+
+// prepare Prepares the statements for the table of kind.
+func (s *SQLiteStore) prepare(kind ClientKind) error {
+	table := clientTable(kind)
+	key := table.Columns[0]
+
+	columns := strings.Join(table.Columns, ", ")
+	updates := make([]string, 0, len(table.Columns)-1)
+	for _, column := range table.Columns[1:] {
+		updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+	}
+	queries := []string{
+		fmt.Sprintf("SELECT %s FROM `%s` WHERE %s = ?", columns, table.Name, key),
+		fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s) ON CONFLICT(%s) DO UPDATE SET %s", table.Name, columns,
+			strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", "), key, strings.Join(updates, ", ")),
+		fmt.Sprintf("SELECT %s FROM `%s` ORDER BY %s", columns, table.Name, key),
+		fmt.Sprintf("DELETE FROM `%s` WHERE %s = ?", table.Name, key),
+		fmt.Sprintf("DELETE FROM `%s`", table.Name),
+		fmt.Sprintf("DELETE FROM `%s` WHERE last_seen < ?", table.Name),
+	}
+	prepared := make([]*sql.Stmt, len(queries))
+	for i, query := range queries {
+		stmt, err := s.db.Prepare(query)
+		if err != nil {
+			return err
+		}
+		prepared[i] = stmt
+	}
+	s.statements[kind] = &clientStatements{
+		get:    prepared[0],
+		upsert: prepared[1],
+		list:   prepared[2],
+		delete: prepared[3],
+		wipe:   prepared[4],
+		prune:  prepared[5],
+	}
+	return nil
+}
+
+// statementsFor Returns the prepared statements for kind
+func (s *SQLiteStore) statementsFor(kind ClientKind) (*clientStatements, error) {
+	statements, ok := s.statements[kind]
+	if !ok {
+		return nil, errUnknownKind(kind)
+	}
+	return statements, nil
+}
+
+// rowScanner Either *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanClientRecord Reads a row selected with every column of a client table
+func scanClientRecord(row rowScanner) (ClientRecord, error) {
+	var record ClientRecord
+	var lastSeen int64
+	err := row.Scan(&record.Key, &record.Queries, &record.Aggression, &record.Rate, &lastSeen,
+		&record.IntervalMean, &record.IntervalVar, &record.CookieMisses, &record.HoneypotHits)
+	if lastSeen != 0 {
+		record.LastSeen = time.Unix(0, lastSeen)
+	}
+	return record, err
+}
+
+// clientRecordValues Returns the values of record in table column order
+func clientRecordValues(record ClientRecord) []interface{} {
+	var lastSeen int64
+	if !record.LastSeen.IsZero() {
+		lastSeen = record.LastSeen.UnixNano()
+	}
+	return []interface{}{record.Key, record.Queries, record.Aggression, record.Rate, lastSeen,
+		record.IntervalMean, record.IntervalVar, record.CookieMisses, record.HoneypotHits}
+}
+
+func (s *SQLiteStore) RecordHit(kind ClientKind, key string, update func(*ClientRecord)) (ClientRecord, error) {
+	statements, err := s.statementsFor(kind)
+	if err != nil {
+		return ClientRecord{}, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return ClientRecord{}, err
+	}
+	defer tx.Rollback()
+
+	record, err := scanClientRecord(tx.Stmt(statements.get).QueryRow(key))
+	if err == sql.ErrNoRows {
+		record = ClientRecord{Key: key}
+	} else if err != nil {
+		return ClientRecord{}, err
+	}
+	update(&record)
+	if _, err := tx.Stmt(statements.upsert).Exec(clientRecordValues(record)...); err != nil {
+		return ClientRecord{}, err
+	}
+	return record, tx.Commit()
+}
+
+func (s *SQLiteStore) Reputation(kind ClientKind, key string) (ClientRecord, bool, error) {
+	statements, err := s.statementsFor(kind)
+	if err != nil {
+		return ClientRecord{}, false, err
+	}
+	record, err := scanClientRecord(statements.get.QueryRow(key))
+	if err == sql.ErrNoRows {
+		return ClientRecord{Key: key}, false, nil
+	}
+	return record, err == nil, err
+}
+
+func (s *SQLiteStore) List(kind ClientKind) ([]ClientRecord, error) {
+	statements, err := s.statementsFor(kind)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := statements.list.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []ClientRecord
+	for rows.Next() {
+		record, err := scanClientRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLiteStore) Reset(kind ClientKind, key string) error {
+	statements, err := s.statementsFor(kind)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		_, err = statements.wipe.Exec()
+	} else {
+		_, err = statements.delete.Exec(key)
+	}
+	return err
+}
+
+func (s *SQLiteStore) Prune(cutoff time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	removed := 0
+	for _, kind := range ClientKinds {
+		result, err := tx.Stmt(s.statements[kind].prune).Exec(cutoff.UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		removed += int(count)
+	}
+	return removed, tx.Commit()
+}
+
+func (s *SQLiteStore) LogRequest(entry RequestEntry) error {
+	_, err := s.logRequest.Exec(entry.Time.UnixNano(), entry.IP, entry.UserAgent, entry.Path, entry.Query,
+		entry.Template, entry.Aggression, int64(entry.Delay), entry.Bytes)
+	return err
+}
+
+func (s *SQLiteStore) Requests(filter RequestFilter) ([]RequestEntry, error) {
+	// The filter decides which conditions apply, so this one query cannot be prepared up front
+	var conditions []string
+	var args []interface{}
+	if filter.IP != "" {
+		conditions = append(conditions, "ip = ?")
+		args = append(args, filter.IP)
+	}
+	if filter.UserAgent != "" {
+		conditions = append(conditions, "useragent = ?")
+		args = append(args, filter.UserAgent)
+	}
+	if filter.PathPrefix != "" {
+		conditions = append(conditions, "substr(path, 1, ?) = ?")
+		args = append(args, len(filter.PathPrefix), filter.PathPrefix)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "time >= ?")
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "time < ?")
+		args = append(args, filter.Until.UnixNano())
+	}
+	query := "SELECT id, time, ip, useragent, path, query, template, aggression, delay, bytes FROM `requests`"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, filter.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []RequestEntry
+	for rows.Next() {
+		var entry RequestEntry
+		var timestamp, delay int64
+		if err := rows.Scan(&entry.ID, &timestamp, &entry.IP, &entry.UserAgent, &entry.Path, &entry.Query,
+			&entry.Template, &entry.Aggression, &delay, &entry.Bytes); err != nil {
+			return nil, err
+		}
+		entry.Time, entry.Delay = time.Unix(0, timestamp), time.Duration(delay)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLiteStore) PruneRequests(cutoff time.Time, maxRows int) (int, error) {
+	var removed int64
+	if !cutoff.IsZero() {
+		result, err := s.pruneRequests.Exec(cutoff.UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		if removed, err = result.RowsAffected(); err != nil {
+			return 0, err
+		}
+	}
+	if maxRows <= 0 {
+		return int(removed), nil
+	}
+	result, err := s.capRequests.Exec(maxRows)
+	if err != nil {
+		return int(removed), err
+	}
+	capped, err := result.RowsAffected()
+	return int(removed + capped), err
+}
+
+func (s *SQLiteStore) WriteBatch(batch Batch) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for kind, records := range batch.Clients {
+		statements, err := s.statementsFor(kind)
+		if err != nil {
+			return err
+		}
+		upsert := tx.Stmt(statements.upsert)
+		for _, record := range records {
+			if _, err := upsert.Exec(clientRecordValues(record)...); err != nil {
+				return err
+			}
+		}
+	}
+	logRequest := tx.Stmt(s.logRequest)
+	for _, entry := range batch.Requests {
+		if _, err := logRequest.Exec(entry.Time.UnixNano(), entry.IP, entry.UserAgent, entry.Path, entry.Query,
+			entry.Template, entry.Aggression, int64(entry.Delay), entry.Bytes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Close() error {
+	for _, stmt := range []*sql.Stmt{s.logRequest, s.pruneRequests, s.capRequests} {
+		stmt.Close()
+	}
+	for _, statements := range s.statements {
+		for _, stmt := range []*sql.Stmt{statements.get, statements.upsert, statements.list, statements.delete,
+			statements.wipe, statements.prune} {
+			stmt.Close()
+		}
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,270 @@
+package utilities
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientKind What a client key identifies. Each kind is stored separately.
+type ClientKind string
+
+const (
+	ClientIP        ClientKind = "ip"
+	ClientUserAgent ClientKind = "useragent"
+	ClientSubnet    ClientKind = "subnet"
+	ClientASN       ClientKind = "asn"
+)
+
+// ClientKinds Every kind of client the tarpit records
+var ClientKinds = []ClientKind{ClientIP, ClientUserAgent, ClientSubnet, ClientASN}
+
+// ClientStore Persists what is known about clients. Implementations must be safe for concurrent use.
+type ClientStore interface {
+	// RecordHit Loads the record of the client of kind identified by key, passes it to update and saves the result.
+	// Updates to the same client are applied one after another.
+	RecordHit(kind ClientKind, key string, update func(*ClientRecord)) (ClientRecord, error)
+	// Reputation Returns the stored record of a client, and false if it has never been seen
+	Reputation(kind ClientKind, key string) (ClientRecord, bool, error)
+	// List Returns every stored client of kind, ordered by key
+	List(kind ClientKind) ([]ClientRecord, error)
+	// Reset Forgets a client, or every client of kind if key is empty
+	Reset(kind ClientKind, key string) error
+	// Prune Forgets every client last seen before cutoff and returns how many were removed
+	Prune(cutoff time.Time) (int, error)
+	// RequestLog Stores also keep the log of requests served
+	RequestLog
+	// Close Releases the store
+	Close() error
+}
+
+// RequestEntry One request served by the tarpit
+type RequestEntry struct {
+	ID         int64
+	Time       time.Time
+	IP         string
+	UserAgent  string
+	Path       string
+	Query      string
+	Template   string
+	Aggression int
+	Delay      time.Duration
+	Bytes      int64
+}
+
+// RequestFilter Selects entries from a RequestLog. Zero fields match everything. Entries come back newest first.
+type RequestFilter struct {
+	IP         string
+	UserAgent  string
+	PathPrefix string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// matches Reports whether entry passes the filter, ignoring Limit and Offset
+func (f RequestFilter) matches(entry RequestEntry) bool {
+	return (f.IP == "" || entry.IP == f.IP) &&
+		(f.UserAgent == "" || entry.UserAgent == f.UserAgent) &&
+		strings.HasPrefix(entry.Path, f.PathPrefix) &&
+		(f.Since.IsZero() || !entry.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.Time.Before(f.Until))
+}
+
+// RequestLog An append-only log of the requests the tarpit served.
+type RequestLog interface {
+	// LogRequest Appends entry to the log. The entry's ID is assigned by the log.
+	LogRequest(entry RequestEntry) error
+	// Requests Returns the entries matching filter, newest first
+	Requests(filter RequestFilter) ([]RequestEntry, error)
+	// PruneRequests Drops entries older than cutoff unless it is zero, then the oldest entries beyond maxRows if maxRows is positive, and
+	// returns how many were removed
+	PruneRequests(cutoff time.Time, maxRows int) (int, error)
+}
+
+// Batch Client records and request log entries written to a store together
+type Batch struct {
+	Clients  map[ClientKind][]ClientRecord
+	Requests []RequestEntry
+}
+
+// BatchStore A ClientStore that can also write many changes in one go, which BatchingStore flushes to.
+type BatchStore interface {
+	ClientStore
+	// WriteBatch Saves every record and appends every entry of batch, all or nothing
+	WriteBatch(batch Batch) error
+}
+
+// errUnknownKind Returned by stores asked about a kind they do not keep
+func errUnknownKind(kind ClientKind) error {
+	return fmt.Errorf("unknown client kind %q", kind)
+}
+
+// MemoryStore A ClientStore that keeps everything in memory, for tests and ephemeral deployments.
+type MemoryStore struct {
+	mu       sync.Mutex
+	clients  map[ClientKind]map[string]ClientRecord
+	requests []RequestEntry
+	nextID   int64
+}
+
+// NewMemoryStore Returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	clients := make(map[ClientKind]map[string]ClientRecord, len(ClientKinds))
+	for _, kind := range ClientKinds {
+		clients[kind] = make(map[string]ClientRecord)
+	}
+	return &MemoryStore{clients: clients}
+}
+
+func (s *MemoryStore) RecordHit(kind ClientKind, key string, update func(*ClientRecord)) (ClientRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients, ok := s.clients[kind]
+	if !ok {
+		return ClientRecord{}, errUnknownKind(kind)
+	}
+	record, ok := clients[key]
+	if !ok {
+		record = ClientRecord{Key: key}
+	}
+	update(&record)
+	clients[key] = record
+	return record, nil
+}
+
+func (s *MemoryStore) Reputation(kind ClientKind, key string) (ClientRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients, ok := s.clients[kind]
+	if !ok {
+		return ClientRecord{}, false, errUnknownKind(kind)
+	}
+	record, ok := clients[key]
+	if !ok {
+		return ClientRecord{Key: key}, false, nil
+	}
+	return record, true, nil
+}
+
+func (s *MemoryStore) List(kind ClientKind) ([]ClientRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients, ok := s.clients[kind]
+	if !ok {
+		return nil, errUnknownKind(kind)
+	}
+	records := make([]ClientRecord, 0, len(clients))
+	for _, record := range clients {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key < records[j].Key
+	})
+	return records, nil
+}
+
+func (s *MemoryStore) Reset(kind ClientKind, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients, ok := s.clients[kind]
+	if !ok {
+		return errUnknownKind(kind)
+	}
+	if key == "" {
+		s.clients[kind] = make(map[string]ClientRecord)
+	} else {
+		delete(clients, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Prune(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for _, clients := range s.clients {
+		for key, record := range clients {
+			if record.LastSeen.Before(cutoff) {
+				delete(clients, key)
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+func (s *MemoryStore) LogRequest(entry RequestEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	entry.ID = s.nextID
+	s.requests = append(s.requests, entry)
+	return nil
+}
+
+func (s *MemoryStore) Requests(filter RequestFilter) ([]RequestEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []RequestEntry
+	skipped := 0
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		if !filter.matches(s.requests[i]) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		entries = append(entries, s.requests[i])
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) PruneRequests(cutoff time.Time, maxRows int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.requests[:0]
+	for _, entry := range s.requests {
+		if !entry.Time.Before(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	if maxRows > 0 && len(kept) > maxRows {
+		kept = append(kept[:0], kept[len(kept)-maxRows:]...)
+	}
+	removed := len(s.requests) - len(kept)
+	s.requests = kept
+	return removed, nil
+}
+
+func (s *MemoryStore) WriteBatch(batch Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for kind := range batch.Clients {
+		if _, ok := s.clients[kind]; !ok {
+			return errUnknownKind(kind)
+		}
+	}
+	for kind, records := range batch.Clients {
+		for _, record := range records {
+			s.clients[kind][record.Key] = record
+		}
+	}
+	for _, entry := range batch.Requests {
+		s.nextID++
+		entry.ID = s.nextID
+		s.requests = append(s.requests, entry)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
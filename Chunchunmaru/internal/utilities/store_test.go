@@ -0,0 +1,100 @@
+package utilities
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testClientStore(t *testing.T, store ClientStore) {
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		record, err := store.RecordHit(ClientIP, "203.0.113.7", func(record *ClientRecord) {
+			record.Record(Hit{Time: start.Add(time.Duration(i) * time.Second)}, time.Hour)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Queries != i+1 {
+			t.Fatalf("expected %d queries, got %d", i+1, record.Queries)
+		}
+	}
+	if _, err := store.RecordHit(ClientIP, "198.51.100.1", func(record *ClientRecord) {
+		record.Record(Hit{Time: start.Add(-48 * time.Hour)}, time.Hour)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	record, ok, err := store.Reputation(ClientIP, "203.0.113.7")
+	if err != nil || !ok || record.Queries != 3 || !record.LastSeen.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("unexpected reputation %+v, %v, %v", record, ok, err)
+	}
+	if _, ok, err := store.Reputation(ClientUserAgent, "203.0.113.7"); ok || err != nil {
+		t.Fatalf("kinds should be stored separately, got %v, %v", ok, err)
+	}
+
+	records, err := store.List(ClientIP)
+	if err != nil || len(records) != 2 || records[0].Key != "198.51.100.1" {
+		t.Fatalf("unexpected listing %+v, %v", records, err)
+	}
+
+	if removed, err := store.Prune(start.Add(-time.Hour)); err != nil || removed != 1 {
+		t.Fatalf("expected to prune 1 client, pruned %d, %v", removed, err)
+	}
+	if err := store.Reset(ClientIP, "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := store.List(ClientIP); len(records) != 0 {
+		t.Fatalf("expected no clients after reset, got %+v", records)
+	}
+	if _, err := store.List("bogus"); err == nil {
+		t.Fatal("expected an error for an unknown kind")
+	}
+}
+
+func testRequestLog(t *testing.T, store ClientStore) {
+	start := time.Now()
+	paths := []string{"/a/1", "/b/1", "/a/2", "/a/3"}
+	for i, path := range paths {
+		entry := RequestEntry{Time: start.Add(time.Duration(i) * time.Minute), IP: "203.0.113.7", UserAgent: "curl", Path: path}
+		if i == 1 {
+			entry.IP = "198.51.100.1"
+		}
+		if err := store.LogRequest(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := store.Requests(RequestFilter{IP: "203.0.113.7", PathPrefix: "/a/", Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/a/2" || entries[1].Path != "/a/1" {
+		t.Fatalf("unexpected page %+v", entries)
+	}
+	if entries, _ = store.Requests(RequestFilter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}); len(entries) != 2 {
+		t.Fatalf("expected 2 entries in range, got %+v", entries)
+	}
+
+	if removed, err := store.PruneRequests(start.Add(30*time.Second), 2); err != nil || removed != 2 {
+		t.Fatalf("expected to prune 2 entries, pruned %d, %v", removed, err)
+	}
+	if entries, _ = store.Requests(RequestFilter{}); len(entries) != 2 || entries[1].Path != "/a/2" {
+		t.Fatalf("expected the newest 2 entries to remain, got %+v", entries)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testClientStore(t, NewMemoryStore())
+	testRequestLog(t, NewMemoryStore())
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testClientStore(t, store)
+	testRequestLog(t, store)
+}
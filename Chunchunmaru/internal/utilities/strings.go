@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math/rand"
 	"regexp"
-	"time"
 )
 
 var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9 ]+`)
@@ -14,9 +13,6 @@ func CleanString(str string) string {
 	return nonAlphanumericRegex.ReplaceAllString(str, "")
 }
 
-var seededRand *rand.Rand = rand.New(
-	rand.NewSource(time.Now().UnixNano()))
-
 const UpperHexChars = "0123456789ABCDEF"
 const LowerHexChars = "0123456789abcdef"
 const UpperAlphabetChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -27,22 +23,22 @@ const SpeciaLChars = "!@#$%^&*()_+-=<>?"
 const MixedDigitChars = AlphabetChars + AlphabetNumericChars
 const AllChars = MixedDigitChars + SpeciaLChars
 
-func RandomStringFromCharset(length int, charset string) string {
+func RandomStringFromCharset(r *rand.Rand, length int, charset string) string {
 	b := make([]byte, length)
 	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+		b[i] = charset[r.Intn(len(charset))]
 	}
 	return string(b)
 }
 
 // RandomKeyword Selects a random item from a slice of strings.
-func RandomKeyword(keywords []string) string {
-	return keywords[rand.Intn(len(keywords))]
+func RandomKeyword(r *rand.Rand, keywords []string) string {
+	return keywords[r.Intn(len(keywords))]
 }
 
 // RandomHexColor Generates a random hexadecimal color.
-func RandomHexColor() string {
-	return fmt.Sprintf("#%06x", rand.Intn(0xFFFFFF))
+func RandomHexColor(r *rand.Rand) string {
+	return fmt.Sprintf("#%06x", r.Intn(0xFFFFFF))
 }
 
 // ReverseString Helper: reverse a string
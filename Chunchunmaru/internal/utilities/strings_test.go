@@ -1,20 +1,23 @@
 package utilities
 
 import (
+	"math/rand"
 	"testing"
 )
 
+var testRand = rand.New(rand.NewSource(42))
+
 func BenchmarkRandomStringFromCharset(b *testing.B) {
-	printTestResults("Random String From Charset", RandomStringFromCharset(12, AlphabetChars))
+	printTestResults("Random String From Charset", RandomStringFromCharset(testRand, 12, AlphabetChars))
 }
 
 func BenchmarkRandomKeyword(b *testing.B) {
 	items := []string{"foo", "bar", "baz"}
-	printTestResults("Random String From Array", RandomKeyword(items))
+	printTestResults("Random String From Array", RandomKeyword(testRand, items))
 }
 
 func BenchmarkRandomHexColor(b *testing.B) {
-	printTestResults("Random Hex Color (string utility)", RandomHexColor())
+	printTestResults("Random Hex Color (string utility)", RandomHexColor(testRand))
 }
 
 func BenchmarkReverseString(b *testing.B) {
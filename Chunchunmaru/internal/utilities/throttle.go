@@ -0,0 +1,130 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrClientGone is returned by a DripWriter once the client has disconnected.
+var ErrClientGone = errors.New("client disconnected")
+
+// DripWriter wraps an http.ResponseWriter and drip-feeds everything written to it to the client in small chunks,
+// sleeping a jittered delay between each chunk. Once the time budget is spent the rest is sent without delay.
+type DripWriter struct {
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	ctx        context.Context
+	buf        []byte
+	chunkSize  int
+	minDelay   time.Duration
+	maxDelay   time.Duration
+	aggression int
+	deadline   time.Time
+	written    int
+}
+
+// NewDripWriter Returns a DripWriter for w using the throttling settings from config. Delays scale up with aggression
+// (0-100), and writing stops as soon as ctx is done.
+func NewDripWriter(ctx context.Context, w http.ResponseWriter, config Config, aggression int) *DripWriter {
+	flusher, _ := w.(http.Flusher)
+	dw := &DripWriter{
+		w:          w,
+		flusher:    flusher,
+		ctx:        ctx,
+		chunkSize:  config.ChunkSize,
+		minDelay:   time.Duration(config.MinChunkDelay),
+		maxDelay:   time.Duration(config.MaxChunkDelay),
+		aggression: ClampInt(aggression, 0, 100),
+	}
+	if config.MaxStreamTime > 0 {
+		dw.deadline = time.Now().Add(time.Duration(config.MaxStreamTime))
+	}
+	return dw
+}
+
+// Write buffers p and sends every full chunk to the client. If a chunk fails to send, the count returned only covers
+// the bytes of p sent before it and those of its own that reached the client.
+func (dw *DripWriter) Write(p []byte) (int, error) {
+	if err := dw.ctx.Err(); err != nil {
+		return 0, ErrClientGone
+	}
+	if dw.chunkSize <= 0 {
+		return dw.send(p)
+	}
+	consumed := 0
+	for consumed < len(p) {
+		take := min(dw.chunkSize-len(dw.buf), len(p)-consumed)
+		dw.buf = append(dw.buf, p[consumed:consumed+take]...)
+		if len(dw.buf) < dw.chunkSize {
+			return len(p), nil
+		}
+		// held Bytes of the chunk buffered by earlier writes
+		held := len(dw.buf) - take
+		written, err := dw.send(dw.buf)
+		dw.buf = dw.buf[:0]
+		if err != nil {
+			return consumed + max(written-held, 0), err
+		}
+		consumed += take
+	}
+	return consumed, nil
+}
+
+// Flush sends whatever is left in the buffer. It must be called once the response has been fully written.
+func (dw *DripWriter) Flush() error {
+	if len(dw.buf) == 0 {
+		return nil
+	}
+	_, err := dw.send(dw.buf)
+	dw.buf = nil
+	return err
+}
+
+// Written Returns the number of bytes actually delivered to the client so far.
+func (dw *DripWriter) Written() int {
+	return dw.written
+}
+
+// send waits out the next delay, then writes and flushes chunk. Returns how many bytes of chunk were written.
+func (dw *DripWriter) send(chunk []byte) (int, error) {
+	if err := dw.wait(); err != nil {
+		return 0, err
+	}
+	written, err := dw.w.Write(chunk)
+	dw.written += written
+	if err != nil {
+		return written, err
+	}
+	if dw.flusher != nil {
+		dw.flusher.Flush()
+	}
+	return written, nil
+}
+
+// wait sleeps for a random delay between minDelay and maxDelay, scaled by aggression, unless the budget is spent.
+func (dw *DripWriter) wait() error {
+	if dw.maxDelay <= 0 && dw.minDelay <= 0 {
+		return nil
+	}
+	if !dw.deadline.IsZero() && time.Now().After(dw.deadline) {
+		return nil
+	}
+	delay := RandomDuration(dw.minDelay, dw.maxDelay)
+	delay += delay * time.Duration(dw.aggression) / 100
+	if !dw.deadline.IsZero() {
+		if remaining := time.Until(dw.deadline); delay > remaining {
+			delay = remaining
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-dw.ctx.Done():
+		return ErrClientGone
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package utilities
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDripWriterChunks(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	config := Config{ChunkSize: 4, MinChunkDelay: Duration(time.Millisecond), MaxChunkDelay: Duration(2 * time.Millisecond)}
+	drip := NewDripWriter(context.Background(), recorder, config, 50)
+
+	payload := strings.Repeat("chunchunmaru", 5)
+	if _, err := drip.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if err := drip.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Body.String() != payload || drip.Written() != len(payload) {
+		t.Fatalf("expected %q, got %q (%d bytes)", payload, recorder.Body.String(), drip.Written())
+	}
+}
+
+func TestDripWriterClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	config := Config{ChunkSize: 1, MinChunkDelay: Duration(time.Hour), MaxChunkDelay: Duration(time.Hour)}
+	drip := NewDripWriter(ctx, httptest.NewRecorder(), config, 0)
+
+	go cancel()
+	if _, err := drip.Write([]byte("abc")); !errors.Is(err, ErrClientGone) {
+		t.Fatalf("expected ErrClientGone, got %v", err)
+	}
+}
+
+// brokenWriter A response writer that accepts limit bytes and then fails
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (bw *brokenWriter) Write(p []byte) (int, error) {
+	if len(p) > bw.limit {
+		written, _ := bw.ResponseRecorder.Write(p[:bw.limit])
+		bw.limit = 0
+		return written, errors.New("connection reset")
+	}
+	bw.limit -= len(p)
+	return bw.ResponseRecorder.Write(p)
+}
+
+func TestDripWriterCountsPartialWrites(t *testing.T) {
+	// Chunks of 4 after 2 bytes held from an earlier write: "ab" + "cd", then "efgh" fails after "ef"
+	writer := &brokenWriter{ResponseRecorder: httptest.NewRecorder(), limit: 6}
+	drip := NewDripWriter(context.Background(), writer, Config{ChunkSize: 4}, 0)
+	if n, err := drip.Write([]byte("ab")); n != 2 || err != nil {
+		t.Fatalf("expected the bytes to be buffered, got %d, %v", n, err)
+	}
+	if n, err := drip.Write([]byte("cdefghij")); n != 4 || err == nil {
+		t.Fatalf("expected 4 bytes consumed and an error, got %d, %v", n, err)
+	}
+	if drip.Written() != 6 {
+		t.Fatalf("expected 6 bytes delivered, got %d", drip.Written())
+	}
+
+	// Unbuffered writes report what reached the client
+	writer = &brokenWriter{ResponseRecorder: httptest.NewRecorder(), limit: 3}
+	drip = NewDripWriter(context.Background(), writer, Config{}, 0)
+	if n, err := drip.Write([]byte("abcdef")); n != 3 || err == nil {
+		t.Fatalf("expected 3 bytes consumed and an error, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"chunchunmaru/internal/utilities"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runMigrate Implements the migrate subcommand, which reports the database's schema version and pending migrations and
+// applies them unless -dry-run is given.
+func runMigrate(args []string) error {
+	// Default to the database the server would open, ignoring the server's own flags
+	config, _, err := utilities.LoadConfig(nil, os.Environ())
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	path := flags.String("db", config.DatabasePath, "path of the database to migrate")
+	dryRun := flags.Bool("dry-run", false, "only report pending migrations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return fmt.Errorf("no database to migrate, pass -db")
+	}
+
+	open := utilities.OpenDatabase
+	if *dryRun {
+		open = utilities.OpenDatabaseReadOnly
+	}
+	db, err := open(*path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	version, err := utilities.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	pending, err := utilities.PendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is at schema version %d with %d pending migration(s)\n", *path, version, len(pending))
+	for _, migration := range pending {
+		fmt.Printf("  %04d_%s\n", migration.Version, migration.Name)
+	}
+	if *dryRun || len(pending) == 0 {
+		return nil
+	}
+
+	if _, err := utilities.Migrate(db); err != nil {
+		return err
+	}
+	version, err = utilities.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Migrated %s to schema version %d\n", *path, version)
+	return nil
+}
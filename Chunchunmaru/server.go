@@ -0,0 +1,131 @@
+package main
+
+import (
+	"chunchunmaru/internal/utilities"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listenAddress Returns the address the tarpit listens on for config
+func listenAddress(config utilities.Config) string {
+	return net.JoinHostPort(config.BindAddress, fmt.Sprint(config.Port))
+}
+
+// isAdminPath Reports whether path belongs to the admin endpoints
+func isAdminPath(path string) bool {
+	return path == "/config" || strings.HasPrefix(path, "/api/")
+}
+
+// routes Returns the handler for the tarpit's address and the one for AdminAddress. Both require auth for /config and
+// /api, and while AdminAddress is set the tarpit's address sends those paths to the tarpit like any other.
+func routes(cm *utilities.ConfigManager, tp http.Handler, api http.HandlerFunc) (public http.Handler, admin http.Handler) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", cm.ConfigAPI)
+	mux.HandleFunc("/api/", api)
+	admin = utilities.RequireAuth(cm, mux)
+	public = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAdminPath(r.URL.Path) && cm.GetConfig().AdminAddress == "" {
+			admin.ServeHTTP(w, r)
+			return
+		}
+		tp.ServeHTTP(w, r)
+	})
+	return public, admin
+}
+
+// server Serves handler on the configured address and moves to a new address when the config changes, letting
+// requests already in flight on the old listener finish.
+type server struct {
+	handler http.Handler
+
+	mu       sync.Mutex
+	current  *http.Server
+	listener net.Listener
+	addr     string
+	// draining Servers that stopped accepting connections but may still be streaming to clients
+	draining sync.WaitGroup
+}
+
+// newServer Returns a server for handler. Call Apply to start listening.
+func newServer(handler http.Handler) *server {
+	return &server{handler: handler}
+}
+
+// Apply Listens on addr, if it isn't already. The previous listener is closed and its connections are drained in the
+// background for up to timeout. If the new address can't be bound the server keeps listening where it was.
+func (s *server) Apply(addr string, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && addr == s.addr {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil && s.listener != nil {
+		// Moving between a wildcard and a specific address on the same port conflicts with ourselves, so let go of
+		// the old socket first and take it back if the new address still can't be bound
+		s.listener.Close()
+		if listener, err = net.Listen("tcp", addr); err != nil {
+			if listener, err = net.Listen("tcp", s.addr); err != nil {
+				return fmt.Errorf("lost listener on %s: %w", s.addr, err)
+			}
+			s.serve(listener)
+			return fmt.Errorf("could not listen on %s, staying on %s", addr, s.addr)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	previous := s.current
+	s.addr = addr
+	s.serve(listener)
+	log.Printf("Listening on %s", addr)
+	if previous != nil {
+		s.drain(previous, timeout)
+	}
+	return nil
+}
+
+// serve Starts serving on listener. Must be called with mu held.
+func (s *server) serve(listener net.Listener) {
+	httpServer := &http.Server{Handler: s.handler}
+	s.current, s.listener = httpServer, listener
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			log.Println("Error serving ", err)
+		}
+	}()
+}
+
+// drain Stops httpServer accepting connections and closes any still open after timeout.
+func (s *server) drain(httpServer *http.Server, timeout time.Duration) {
+	s.draining.Add(1)
+	go func() {
+		defer s.draining.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Println("Timed out draining connections, closing them ", err)
+			httpServer.Close()
+		}
+	}()
+}
+
+// Shutdown Stops accepting connections and waits up to timeout for every server, including ones still draining from
+// earlier rebinds, to finish.
+func (s *server) Shutdown(timeout time.Duration) {
+	s.mu.Lock()
+	if s.current != nil {
+		s.drain(s.current, timeout)
+		s.current, s.listener = nil, nil
+	}
+	s.mu.Unlock()
+	s.draining.Wait()
+}
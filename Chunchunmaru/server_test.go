@@ -0,0 +1,106 @@
+package main
+
+import (
+	"chunchunmaru/internal/utilities"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// listenerURL Returns the URL of the address srv is listening on
+func listenerURL(srv *server) string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return "http://" + srv.listener.Addr().String()
+}
+
+func TestServerRebindKeepsInFlightRequests(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		io.WriteString(w, "ok")
+	}))
+
+	config := utilities.DefaultConfig()
+	config.Port = 0
+	config.BindAddress = "127.0.0.1"
+	if err := srv.Apply(listenAddress(config), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown(time.Second)
+	oldURL := listenerURL(srv)
+
+	slow := make(chan error, 1)
+	go func() {
+		response, err := http.Get(oldURL + "/slow")
+		if err == nil {
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			if string(body) != "ok" {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		slow <- err
+	}()
+	<-started
+
+	config.BindAddress = "localhost"
+	if err := srv.Apply(listenAddress(config), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	newURL := listenerURL(srv)
+	if newURL == oldURL {
+		t.Fatal("expected a new listener")
+	}
+	response, err := http.Get(newURL + "/")
+	if err != nil {
+		t.Fatalf("new listener not serving: %v", err)
+	}
+	response.Body.Close()
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatalf("in-flight request was dropped: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	if _, err := client.Get(oldURL + "/"); err == nil {
+		t.Fatal("old listener still accepting connections")
+	}
+}
+
+func TestRoutesMoveAdminEndpoints(t *testing.T) {
+	cm := utilities.NewConfigManager(utilities.DefaultConfig())
+	tp := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "tarpit")
+	})
+	api := func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "api")
+	}
+	public, admin := routes(cm, tp, api)
+	get := func(handler http.Handler, path string) string {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.RemoteAddr = "127.0.0.1:5000"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Body.String()
+	}
+
+	if body := get(public, "/api/server/info"); body != "api" {
+		t.Fatalf("expected the API on the public address, got %q", body)
+	}
+	config := cm.GetConfig()
+	config.AdminAddress = "127.0.0.1:8081"
+	cm.SetConfig(config)
+	if body := get(public, "/api/server/info"); body != "tarpit" {
+		t.Fatalf("expected the tarpit once the API moved, got %q", body)
+	}
+	if body := get(admin, "/api/server/info"); body != "api" {
+		t.Fatalf("expected the API on the admin address, got %q", body)
+	}
+}
@@ -0,0 +1,852 @@
+package tarpit
+
+import (
+	"chunchunmaru/internal/macros"
+	"chunchunmaru/internal/utilities"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateDir Returns the directory the tarpit's templates are served from, if they come from one
+func (t *Tarpit) templateDir() (string, bool) {
+	switch templates := t.templates.(type) {
+	case TemplateDir:
+		return string(templates), true
+	case *TemplateRegistry:
+		return templates.Dir(), true
+	}
+	return "", false
+}
+
+// reloadTemplates Picks up changes made through the API right away, rather than at the next watch
+func (t *Tarpit) reloadTemplates() {
+	if registry, ok := t.templates.(*TemplateRegistry); ok {
+		if err := registry.Reload(); err != nil {
+			log.Println("Error reloading templates ", err)
+		}
+	}
+}
+
+// defaultRequestLogLimit and maxRequestLogLimit Bound the page size of the request log endpoint
+const (
+	defaultRequestLogLimit = 100
+	maxRequestLogLimit     = 1000
+)
+
+// Defaults and limits for the sample sentences and verbatim copy trials of the Markov model info endpoint
+const (
+	defaultModelSamples = 5
+	maxModelSamples     = 50
+	defaultModelTrials  = 500
+	maxModelTrials      = 10000
+)
+
+// parseRequestFilter Reads a request log filter from query parameters. Times may be RFC 3339 or Unix seconds.
+func parseRequestFilter(query url.Values) (utilities.RequestFilter, error) {
+	filter := utilities.RequestFilter{
+		IP:         query.Get("ip"),
+		UserAgent:  query.Get("useragent"),
+		PathPrefix: query.Get("path"),
+		Limit:      defaultRequestLogLimit,
+	}
+	var err error
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		return filter, fmt.Errorf("invalid since: %w", err)
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		return filter, fmt.Errorf("invalid until: %w", err)
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 {
+			return filter, fmt.Errorf("invalid limit %q", value)
+		}
+		filter.Limit = min(filter.Limit, maxRequestLogLimit)
+	}
+	if value := query.Get("offset"); value != "" {
+		if filter.Offset, err = strconv.Atoi(value); err != nil || filter.Offset < 0 {
+			return filter, fmt.Errorf("invalid offset %q", value)
+		}
+	}
+	return filter, nil
+}
+
+// parseTimeParam Parses an RFC 3339 timestamp or a number of Unix seconds. Empty means the zero time.
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// validTemplateName Checks that name is a plain .html file name, so it can't point outside the templates directory
+func validTemplateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("JSON field \"fileName\" must not be empty.")
+	case strings.ContainsAny(name, `/\`) || name != filepath.Base(name) || strings.Contains(name, ".."):
+		return errors.New("File name must not contain path separators.")
+	case !strings.HasSuffix(strings.ToLower(name), ".html") || strings.HasPrefix(name, "."):
+		return errors.New("File name must end in .html.")
+	}
+	return nil
+}
+
+// apiTemplateError Converts a template error for an API reply
+func apiTemplateError(templateErr macros.TemplateError) utilities.ApiTemplateError {
+	return utilities.ApiTemplateError{
+		Phase:      templateErr.Phase,
+		Aggression: templateErr.Aggression,
+		Line:       templateErr.Line,
+		Column:     templateErr.Column,
+		Message:    templateErr.Message,
+	}
+}
+
+// writeTemplateReply Writes the result of a template upload
+func writeTemplateReply(w http.ResponseWriter, status int, reply utilities.ApiUploadTemplateReply) {
+	replybytes, marshalerr := json.Marshal(reply)
+	if marshalerr != nil {
+		log.Println("Error marshalling json ", marshalerr)
+		handleWebError(w, marshalerr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, writeerr := w.Write(replybytes); writeerr != nil {
+		log.Println("Error writing json ", writeerr)
+	}
+}
+
+func handleWebError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func handleWebErrorWithMessage(w http.ResponseWriter, err string) {
+	http.Error(w, err, http.StatusInternalServerError)
+}
+
+// APIHandler Serves the admin API under /api/.
+func (t *Tarpit) APIHandler(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		// GET api methods
+		writer.Header().Add("Content-Type", "application/json")
+		switch request.URL.Path {
+		case "/api/server/info":
+			// Provides generic server info to the client
+			reply := utilities.ApiBaseInfoReply{
+				AppVersion: "1.0.0",
+				Uptime:     t.Uptime().Seconds(),
+				Os:         cases.Title(language.English, cases.Compact).String(runtime.GOOS),
+				Arch:       cases.Title(language.English, cases.Compact).String(runtime.GOARCH),
+			}
+			replybytes, marshalerr := json.Marshal(reply)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/server/stats":
+			// Provides the client store's queue metrics. Stores that write through report zeros.
+			var reply utilities.StoreStats
+			if batching, ok := t.store.(*BatchingStore); ok {
+				reply = batching.Stats()
+			}
+			replybytes, marshalerr := json.Marshal(reply)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/templates/info":
+			// Provides misc template information to the client
+			if registry, ok := t.templates.(*TemplateRegistry); ok {
+				reply := utilities.ApiTemplateInfoReply{
+					FileNames: make([]string, 0),
+					Templates: make([]utilities.ApiTemplateFileInfo, 0),
+				}
+				for _, info := range registry.Templates() {
+					tags := info.FrontMatter.Tags
+					if tags == nil {
+						tags = []string{}
+					}
+					fileInfo := utilities.ApiTemplateFileInfo{
+						FileName:      info.Name,
+						Size:          info.Size,
+						Modified:      info.ModTime,
+						MinAggression: info.FrontMatter.MinAggression,
+						MaxAggression: info.FrontMatter.MaxAggression,
+						Weight:        info.FrontMatter.Weight,
+						Tags:          tags,
+						ContentType:   info.FrontMatter.ContentType,
+						CacheControl:  info.FrontMatter.CacheControl,
+						Expires:       info.FrontMatter.Expires.Seconds(),
+					}
+					if info.Err != nil {
+						fileInfo.Error = info.Err.Error()
+					}
+					reply.FileNames = append(reply.FileNames, info.Name)
+					reply.Templates = append(reply.Templates, fileInfo)
+					reply.TotalDiskUsage += info.Size
+				}
+				reply.Count = len(reply.FileNames)
+				replybytes, marshalerr := json.Marshal(reply)
+				if marshalerr != nil {
+					log.Println("Error marshalling json ", marshalerr)
+					handleWebError(writer, marshalerr)
+					return
+				}
+				_, writeerr := writer.Write(replybytes)
+				if writeerr != nil {
+					log.Println("Error writing json ", writeerr)
+					handleWebError(writer, writeerr)
+					return
+				}
+				break
+			}
+			dir, ok := t.templateDir()
+			if !ok {
+				handleWebErrorWithMessage(writer, "Templates are not served from a directory.")
+				return
+			}
+			filenames := make([]string, 0)
+			files, readerr := os.ReadDir(dir)
+			if readerr != nil {
+				log.Println("Error reading templates dir ", readerr)
+				handleWebError(writer, readerr)
+				return
+			}
+			for _, file := range files {
+				filenames = append(filenames, file.Name())
+			}
+			templatesDirSize, _ := utilities.DirSize(dir)
+			reply := utilities.ApiTemplateInfoReply{
+				Count:          len(files),
+				FileNames:      filenames,
+				TotalDiskUsage: templatesDirSize,
+			}
+			replybytes, marshalerr := json.Marshal(reply)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/logging/queries/ip":
+			records, iperr := currentRecords(t.store, t.config.GetConfig(), utilities.ClientIP)
+			if iperr != nil {
+				log.Println("Error fetching ip info ", iperr)
+				handleWebError(writer, iperr)
+				return
+			}
+
+			ipQueries := make([]utilities.IpInfoStruct, 0, len(records))
+			for _, record := range records {
+				ipQueries = append(ipQueries, utilities.IpInfoStruct{
+					Ip:         record.Key,
+					Queries:    record.Queries,
+					Aggression: record.Aggression,
+					Rate:       record.Rate,
+					LastSeen:   unixNano(record.LastSeen),
+				})
+			}
+
+			replybytes, marshalerr := json.Marshal(ipQueries)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/logging/queries/useragent":
+			records, iperr := currentRecords(t.store, t.config.GetConfig(), utilities.ClientUserAgent)
+			if iperr != nil {
+				log.Println("Error fetching agent info ", iperr)
+				handleWebError(writer, iperr)
+				return
+			}
+
+			uaQueries := make([]utilities.UserAgentInfoStruct, 0, len(records))
+			for _, record := range records {
+				uaQueries = append(uaQueries, utilities.UserAgentInfoStruct{
+					UserAgent:  record.Key,
+					Queries:    record.Queries,
+					Aggression: record.Aggression,
+					Rate:       record.Rate,
+					LastSeen:   unixNano(record.LastSeen),
+				})
+			}
+
+			replybytes, marshalerr := json.Marshal(uaQueries)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/logging/queries/subnet", "/api/logging/queries/asn":
+			kind := utilities.ClientSubnet
+			if request.URL.Path == "/api/logging/queries/asn" {
+				kind = utilities.ClientASN
+			}
+			records, aggerr := currentRecords(t.store, t.config.GetConfig(), kind)
+			if aggerr != nil {
+				log.Println("Error fetching aggregate info ", aggerr)
+				handleWebError(writer, aggerr)
+				return
+			}
+
+			aggregateQueries := make([]utilities.AggregateInfoStruct, 0, len(records))
+			for _, record := range records {
+				aggregateQueries = append(aggregateQueries, utilities.AggregateInfoStruct{
+					Key:        record.Key,
+					Queries:    record.Queries,
+					Aggression: record.Aggression,
+					Rate:       record.Rate,
+					LastSeen:   unixNano(record.LastSeen),
+				})
+			}
+
+			replybytes, marshalerr := json.Marshal(aggregateQueries)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/logging/requests":
+			// Pages through the request log, filtered by ip, useragent, path prefix and a since/until time range
+			filter, filtererr := parseRequestFilter(request.URL.Query())
+			if filtererr != nil {
+				http.Error(writer, filtererr.Error(), http.StatusBadRequest)
+				return
+			}
+
+			entries, logerr := t.store.Requests(filter)
+			if logerr != nil {
+				log.Println("Error fetching request log ", logerr)
+				handleWebError(writer, logerr)
+				return
+			}
+
+			reply := utilities.ApiRequestLogReply{
+				Requests: make([]utilities.ApiRequestLogEntry, 0, len(entries)),
+				Limit:    filter.Limit,
+				Offset:   filter.Offset,
+			}
+			for _, entry := range entries {
+				reply.Requests = append(reply.Requests, utilities.ApiRequestLogEntry{
+					ID:         entry.ID,
+					Time:       entry.Time,
+					IP:         entry.IP,
+					UserAgent:  entry.UserAgent,
+					Path:       entry.Path,
+					Query:      entry.Query,
+					Template:   entry.Template,
+					Aggression: entry.Aggression,
+					Delay:      entry.Delay.Seconds(),
+					Bytes:      entry.Bytes,
+				})
+			}
+
+			replybytes, marshalerr := json.Marshal(reply)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/logging/queries/info":
+			totalIpQueries, iperr := sumQueries(t.store, utilities.ClientIP)
+			if iperr != nil {
+				log.Println("Error summarizing ip info ", iperr)
+				handleWebError(writer, iperr)
+				return
+			}
+
+			totalUaQueries, uaerr := sumQueries(t.store, utilities.ClientUserAgent)
+			if uaerr != nil {
+				log.Println("Error summarizing ua info ", uaerr)
+				handleWebError(writer, uaerr)
+				return
+			}
+
+			replybytes, marshalerr := json.Marshal(utilities.ApiQueryInfoReply{
+				TotalQueries: totalIpQueries + totalUaQueries,
+			})
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/markov/list":
+			// Lists the loaded Markov models
+			reply := utilities.ApiMarkovListReply{Models: make([]utilities.ApiMarkovModelInfo, 0)}
+			for _, name := range utilities.MarkovModels.Names() {
+				chain := utilities.MarkovModels.Get(name)
+				if chain == nil {
+					continue
+				}
+				info := utilities.ApiMarkovModelInfo{Name: name, Order: chain.Order}
+				if stat, staterr := os.Stat(filepath.Join(utilities.MarkovModels.Dir(), name+".json")); staterr == nil {
+					info.Size = stat.Size()
+				}
+				reply.Models = append(reply.Models, info)
+			}
+			replybytes, marshalerr := json.Marshal(reply)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/markov/info":
+			// Describes a Markov model, with sample sentences and how often its output copies its training data
+			query := request.URL.Query()
+			name := query.Get("model")
+			if name == "" {
+				name = utilities.DefaultModel
+			}
+			samples, trials := defaultModelSamples, defaultModelTrials
+			var parseerr error
+			if value := query.Get("samples"); value != "" {
+				if samples, parseerr = strconv.Atoi(value); parseerr != nil || samples < 0 || samples > maxModelSamples {
+					http.Error(writer, fmt.Sprintf("samples must be between 0 and %d", maxModelSamples), http.StatusBadRequest)
+					return
+				}
+			}
+			if value := query.Get("trials"); value != "" {
+				if trials, parseerr = strconv.Atoi(value); parseerr != nil || trials < 0 || trials > maxModelTrials {
+					http.Error(writer, fmt.Sprintf("trials must be between 0 and %d", maxModelTrials), http.StatusBadRequest)
+					return
+				}
+			}
+			if utilities.MarkovModels.Get(name) == nil {
+				http.Error(writer, "Model does not exist.", http.StatusNotFound)
+				return
+			}
+			reply, statserr := utilities.MarkovModels.Stats(name, samples, trials, rand.New(rand.NewSource(time.Now().UnixNano())))
+			if statserr != nil {
+				log.Println("Error describing Markov model ", statserr)
+				handleWebError(writer, statserr)
+				return
+			}
+			replybytes, marshalerr := json.Marshal(reply)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		case "/api/markov/export":
+			// Sends a Markov model as saved on disk, ready to be dropped into another instance's models directory
+			name, nameerr := utilities.ModelName(request.URL.Query().Get("model"))
+			if nameerr != nil {
+				http.Error(writer, nameerr.Error(), http.StatusBadRequest)
+				return
+			}
+			modelbytes, exporterr := utilities.MarkovModels.Export(name)
+			if exporterr != nil {
+				http.Error(writer, exporterr.Error(), http.StatusNotFound)
+				return
+			}
+			writer.Header().Set("Content-Disposition", "attachment; filename=\""+name+".json\"")
+			_, writeerr := writer.Write(modelbytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				handleWebError(writer, writeerr)
+				return
+			}
+			break
+		default:
+			handleWebErrorWithMessage(writer, "Unknown or unsupported API endpoint. Did you mean to send a POST request instead?")
+			break
+		}
+		break
+	case http.MethodPost:
+		// POST api methods
+		switch request.URL.Path {
+		case "/api/templates/upload":
+			// Allow a client to upload a template to the web server for serving
+			dir, ok := t.templateDir()
+			if !ok {
+				handleWebErrorWithMessage(writer, "Templates are not served from a directory.")
+				return
+			}
+			decoder := json.NewDecoder(request.Body)
+			var data utilities.ApiUploadTemplateData
+			decoderr := decoder.Decode(&data)
+			if decoderr != nil {
+				log.Println("Error decoding json ", decoderr)
+				handleWebError(writer, decoderr)
+				return
+			}
+			reply := utilities.ApiUploadTemplateReply{FileName: data.FileName, Errors: []utilities.ApiTemplateError{}}
+			if nameerr := validTemplateName(data.FileName); nameerr != nil {
+				reply.Message = nameerr.Error()
+				writeTemplateReply(writer, http.StatusBadRequest, reply)
+				return
+			}
+			decodedhtml, base64err := base64.StdEncoding.DecodeString(data.ContentBase64)
+			if base64err != nil || len(decodedhtml) == 0 {
+				reply.Message = "JSON field \"contentBase64\" must be non-empty base64."
+				writeTemplateReply(writer, http.StatusBadRequest, reply)
+				return
+			}
+
+			// Parse and trial render before anything touches the directory
+			for _, templateErr := range macros.CheckTemplate(data.FileName, string(decodedhtml), t.templateBase(), t.config.GetConfig()) {
+				reply.Errors = append(reply.Errors, apiTemplateError(templateErr))
+			}
+			if len(reply.Errors) > 0 {
+				reply.Message = "Template has errors and was not saved."
+				writeTemplateReply(writer, http.StatusUnprocessableEntity, reply)
+				return
+			}
+
+			writefilerr := utilities.WriteFileAtomic(filepath.Join(dir, data.FileName), decodedhtml, 0644)
+			if writefilerr != nil {
+				log.Println("Error writing file ", writefilerr)
+				handleWebError(writer, writefilerr)
+				return
+			}
+			t.reloadTemplates()
+			reply.Saved = true
+			reply.Message = "Template saved."
+			writeTemplateReply(writer, http.StatusOK, reply)
+			break
+		case "/api/templates/render":
+			// Previews a template at any aggression without recording a client, so tuning doesn't skew the stats
+			decoder := json.NewDecoder(request.Body)
+			var data utilities.ApiRenderTemplateData
+			decoderr := decoder.Decode(&data)
+			if decoderr != nil {
+				log.Println("Error decoding json ", decoderr)
+				http.Error(writer, decoderr.Error(), http.StatusBadRequest)
+				return
+			}
+			if data.Aggression < 0 || data.Aggression > 100 {
+				http.Error(writer, "Aggression must be between 0 and 100.", http.StatusBadRequest)
+				return
+			}
+			name, source := data.Template, data.Source
+			if (name == "") == (source == "") {
+				http.Error(writer, "Exactly one of the JSON fields \"template\" and \"source\" must be given.", http.StatusBadRequest)
+				return
+			}
+			if source == "" {
+				dir, ok := t.templateDir()
+				if !ok {
+					handleWebErrorWithMessage(writer, "Templates are not served from a directory.")
+					return
+				}
+				if nameerr := validTemplateName(name); nameerr != nil {
+					http.Error(writer, nameerr.Error(), http.StatusBadRequest)
+					return
+				}
+				content, readerr := os.ReadFile(filepath.Join(dir, name))
+				if errors.Is(readerr, os.ErrNotExist) {
+					http.Error(writer, "Template does not exist.", http.StatusNotFound)
+					return
+				} else if readerr != nil {
+					log.Println("Error reading template ", readerr)
+					handleWebError(writer, readerr)
+					return
+				}
+				source = string(content)
+			} else {
+				name = "preview"
+			}
+			seed := rand.Int63()
+			if data.Seed != nil {
+				seed = *data.Seed
+			}
+
+			reply := utilities.ApiRenderTemplateReply{Seed: seed, Aggression: data.Aggression, Errors: []utilities.ApiTemplateError{}}
+			status := http.StatusOK
+			preview, rendererr := macros.RenderPreview(name, source, t.templateBase(), data.Aggression, seed, t.config.GetConfig())
+			var templateErr macros.TemplateError
+			if errors.As(rendererr, &templateErr) {
+				reply.Errors = append(reply.Errors, apiTemplateError(templateErr))
+				status = http.StatusUnprocessableEntity
+			}
+			reply.HTML = preview.HTML
+			reply.RenderTime = preview.Duration.Seconds()
+			reply.Bytes = len(preview.HTML)
+			reply.Macros = preview.MacroCalls
+			reply.Tiers = preview.Tiers
+			for _, calls := range preview.MacroCalls {
+				reply.MacroCalls += calls
+			}
+
+			replybytes, marshalerr := json.Marshal(reply)
+			if marshalerr != nil {
+				log.Println("Error marshalling json ", marshalerr)
+				handleWebError(writer, marshalerr)
+				return
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(status)
+			_, writeerr := writer.Write(replybytes)
+			if writeerr != nil {
+				log.Println("Error writing json ", writeerr)
+				return
+			}
+			break
+		case "/api/templates/delete":
+			dir, ok := t.templateDir()
+			if !ok {
+				handleWebErrorWithMessage(writer, "Templates are not served from a directory.")
+				return
+			}
+			decoder := json.NewDecoder(request.Body)
+			var data utilities.ApiDeleteTemplateData
+			decoderr := decoder.Decode(&data)
+			if decoderr != nil {
+				log.Println("Error decoding json ", decoderr)
+				handleWebError(writer, decoderr)
+				return
+			}
+			if nameerr := validTemplateName(data.FileName); data.FileName != "" && nameerr != nil {
+				http.Error(writer, nameerr.Error(), http.StatusBadRequest)
+				return
+			}
+			if data.FileName != "" {
+				if utilities.FileExists(filepath.Join(dir, data.FileName)) {
+					delfileerr := os.Remove(filepath.Join(dir, data.FileName))
+					if delfileerr != nil {
+						log.Println("Error deleting file ", delfileerr)
+						handleWebError(writer, delfileerr)
+						return
+					}
+					t.reloadTemplates()
+					writer.Header().Add("Content-Type", "text/html")
+					writer.Write([]byte("OK"))
+				} else {
+					handleWebErrorWithMessage(writer, "File does not exist.")
+					return
+				}
+			} else {
+				handleWebErrorWithMessage(writer, "JSON field \"fileName\" must not be empty.")
+				return
+			}
+			break
+		case "/api/markov/train":
+			decoder := json.NewDecoder(request.Body)
+			var data utilities.ApiMarkovTrainData
+			decoderr := decoder.Decode(&data)
+			if decoderr != nil {
+				log.Println("Error decoding json ", decoderr)
+				handleWebError(writer, decoderr)
+				return
+			}
+			if data.Model == "" {
+				data.Model = utilities.DefaultModel
+			}
+			if _, nameerr := utilities.ModelName(data.Model); nameerr != nil {
+				http.Error(writer, nameerr.Error(), http.StatusBadRequest)
+				return
+			}
+			if data.Corpus != "" {
+				_, trainerr := utilities.MarkovModels.Train(data.Model, data.Corpus)
+				if trainerr != nil {
+					log.Println("Error training Markov model ", trainerr)
+					handleWebError(writer, trainerr)
+					return
+				}
+				writer.Header().Add("Content-Type", "text/html")
+				writer.Write([]byte("OK"))
+			} else {
+				handleWebErrorWithMessage(writer, "Corpus must not be empty.")
+				return
+			}
+			break
+		case "/api/markov/upload":
+			// Trains a model on files streamed as multipart/form-data, or on the request body as a single file named by
+			// the fileName parameter, and reports progress as one JSON object per line while they are read
+			name := request.URL.Query().Get("model")
+			if name == "" {
+				name = utilities.DefaultModel
+			}
+			name, nameerr := utilities.ModelName(name)
+			if nameerr != nil {
+				http.Error(writer, nameerr.Error(), http.StatusBadRequest)
+				return
+			}
+			maxSize := int64(t.config.GetConfig().CorpusMaxFileSize)
+			read := func(trainer *utilities.CorpusTrainer) error {
+				fileName := request.URL.Query().Get("fileName")
+				if fileName == "" {
+					fileName = "corpus.txt"
+				}
+				return utilities.ReadCorpus(fileName, request.Body, maxSize, trainer)
+			}
+			if strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/") {
+				parts, multiparterr := request.MultipartReader()
+				if multiparterr != nil {
+					http.Error(writer, multiparterr.Error(), http.StatusBadRequest)
+					return
+				}
+				read = func(trainer *utilities.CorpusTrainer) error {
+					for {
+						part, parterr := parts.NextPart()
+						if errors.Is(parterr, io.EOF) {
+							return nil
+						} else if parterr != nil {
+							return parterr
+						}
+						if part.FileName() != "" {
+							if readerr := utilities.ReadCorpus(part.FileName(), part, maxSize, trainer); readerr != nil {
+								return readerr
+							}
+						}
+						part.Close()
+					}
+				}
+			}
+
+			// Progress is written while the upload is still being read
+			controller := http.NewResponseController(writer)
+			controller.EnableFullDuplex()
+			writer.Header().Set("Content-Type", "application/x-ndjson")
+			encoder := json.NewEncoder(writer)
+			report := func(progress utilities.ApiMarkovUploadProgress) {
+				if encodeerr := encoder.Encode(progress); encodeerr != nil {
+					log.Println("Error writing json ", encodeerr)
+					return
+				}
+				controller.Flush()
+			}
+			_, stats, trainerr := utilities.MarkovModels.TrainFrom(name, read, func(stats utilities.CorpusStats) {
+				report(utilities.ApiMarkovUploadProgress{Model: name, CorpusStats: stats})
+			})
+			final := utilities.ApiMarkovUploadProgress{Model: name, CorpusStats: stats, Done: trainerr == nil}
+			if trainerr != nil {
+				log.Println("Error training Markov model ", trainerr)
+				final.Error = trainerr.Error()
+			}
+			report(final)
+			break
+		case "/api/markov/delete":
+			decoder := json.NewDecoder(request.Body)
+			var data utilities.ApiMarkovModelData
+			decoderr := decoder.Decode(&data)
+			if decoderr != nil {
+				log.Println("Error decoding json ", decoderr)
+				handleWebError(writer, decoderr)
+				return
+			}
+			if _, nameerr := utilities.ModelName(data.Model); nameerr != nil {
+				http.Error(writer, nameerr.Error(), http.StatusBadRequest)
+				return
+			}
+			if utilities.MarkovModels.Get(data.Model) == nil {
+				http.Error(writer, "Model does not exist.", http.StatusNotFound)
+				return
+			}
+			deleteerr := utilities.MarkovModels.Delete(data.Model)
+			if deleteerr != nil {
+				log.Println("Error deleting Markov model ", deleteerr)
+				handleWebError(writer, deleteerr)
+				return
+			}
+			writer.Header().Add("Content-Type", "text/html")
+			writer.Write([]byte("OK"))
+			break
+		default:
+			handleWebErrorWithMessage(writer, "Unknown or unsupported API endpoint. Did you mean to send a GET request instead?")
+			break
+		}
+		break
+	default:
+		// Client used an unsupported request method
+		handleWebErrorWithMessage(writer, "Unsupported method \""+request.Method+"\".")
+		break
+	}
+}
@@ -0,0 +1,250 @@
+package tarpit
+
+import (
+	"bytes"
+	"chunchunmaru/internal/utilities"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func uploadTemplate(t *testing.T, tp *Tarpit, name, content string) (int, utilities.ApiUploadTemplateReply) {
+	body, _ := json.Marshal(utilities.ApiUploadTemplateData{
+		FileName:      name,
+		ContentBase64: base64.StdEncoding.EncodeToString([]byte(content)),
+	})
+	recorder := httptest.NewRecorder()
+	tp.APIHandler(recorder, httptest.NewRequest(http.MethodPost, "/api/templates/upload", strings.NewReader(string(body))))
+	var reply utilities.ApiUploadTemplateReply
+	if err := json.NewDecoder(recorder.Body).Decode(&reply); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return recorder.Code, reply
+}
+
+func TestUploadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tp := New(NewConfigManager(DefaultConfig()), NewMemoryStore(), TemplateDir(dir))
+
+	for _, name := range []string{"../escape.html", `..\escape.html`, "sub/page.html", "page.txt", ".html", ""} {
+		if status, reply := uploadTemplate(t, tp, name, "<p></p>"); status != http.StatusBadRequest || reply.Saved {
+			t.Errorf("%q: expected 400, got %d %+v", name, status, reply)
+		}
+	}
+
+	status, reply := uploadTemplate(t, tp, "broken.html", "<p>\n{{ randomWord }\n</p>")
+	if status != http.StatusUnprocessableEntity || len(reply.Errors) != 1 || reply.Errors[0].Phase != "parse" || reply.Errors[0].Line != 2 {
+		t.Fatalf("expected a parse error on line 2, got %d %+v", status, reply)
+	}
+	status, reply = uploadTemplate(t, tp, "broken.html", "<p>\n\n{{ .Missing }}</p>")
+	if status != http.StatusUnprocessableEntity || len(reply.Errors) != 3 || reply.Errors[2].Aggression != 100 || reply.Errors[0].Line != 3 {
+		t.Fatalf("expected an execute error on line 3 at every aggression, got %d %+v", status, reply)
+	}
+	if utilities.FileExists(filepath.Join(dir, "broken.html")) {
+		t.Fatal("broken template was saved")
+	}
+
+	status, reply = uploadTemplate(t, tp, "page.html", "<p>{{ randomWord }} {{ .Aggression }}</p>")
+	if status != http.StatusOK || !reply.Saved {
+		t.Fatalf("expected the template to be saved, got %d %+v", status, reply)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "page.html")); err != nil || !strings.Contains(string(content), "randomWord") {
+		t.Fatalf("saved template %q, %v", content, err)
+	}
+}
+
+func TestRenderTemplatePreview(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+	tp := New(NewConfigManager(DefaultConfig()), store, TemplateDir(dir))
+	source := "{{- $aggression := .Aggression -}}\n{{- $tier2 := ge $aggression 25 -}}\n{{- $tier3 := ge $aggression 50 -}}\n" +
+		"<p>{{ randomWord }} {{ randomWord }}{{ if $tier2 }} {{ randomInt 1 9 }}{{ end }}</p>"
+	if err := os.WriteFile(filepath.Join(dir, "tiers.html"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	render := func(body string) (int, utilities.ApiRenderTemplateReply) {
+		recorder := httptest.NewRecorder()
+		tp.APIHandler(recorder, httptest.NewRequest(http.MethodPost, "/api/templates/render", strings.NewReader(body)))
+		var reply utilities.ApiRenderTemplateReply
+		if recorder.Code == http.StatusOK || recorder.Code == http.StatusUnprocessableEntity {
+			if err := json.NewDecoder(recorder.Body).Decode(&reply); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return recorder.Code, reply
+	}
+
+	status, reply := render(`{"template": "tiers.html", "aggression": 30, "seed": 7}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if !reply.Tiers["$tier2"] || reply.Tiers["$tier3"] || reply.Macros["randomWord"] != 2 || reply.MacroCalls != 3 || reply.Seed != 7 {
+		t.Fatalf("unexpected metadata %+v", reply)
+	}
+	if reply.Bytes != len(reply.HTML) || !strings.HasPrefix(reply.HTML, "<p>") {
+		t.Fatalf("unexpected html %q", reply.HTML)
+	}
+	if _, again := render(`{"template": "tiers.html", "aggression": 30, "seed": 7}`); again.HTML != reply.HTML {
+		t.Fatal("the same seed rendered a different preview")
+	}
+
+	if status, reply := render(`{"source": "<p>{{ .Missing }}</p>", "aggression": 0}`); status != http.StatusUnprocessableEntity || len(reply.Errors) != 1 {
+		t.Fatalf("expected an execute error, got %d %+v", status, reply)
+	}
+	for _, body := range []string{`{"aggression": 10}`, `{"template": "tiers.html", "aggression": 101}`, `{"template": "../tiers.html"}`} {
+		if status, _ := render(body); status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+
+	for _, kind := range utilities.ClientKinds {
+		if records, _ := store.List(kind); len(records) != 0 {
+			t.Fatalf("preview recorded %d %s clients", len(records), kind)
+		}
+	}
+}
+
+func TestMarkovModelsAPI(t *testing.T) {
+	models := utilities.MarkovModels
+	utilities.MarkovModels = utilities.NewModelRegistry(t.TempDir())
+	defer func() { utilities.MarkovModels = models }()
+	tp := New(NewConfigManager(DefaultConfig()), NewMemoryStore(), TemplateDir(t.TempDir()))
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		tp.APIHandler(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	if recorder := call(http.MethodPost, "/api/markov/train", `{"model": "../x", "corpus": "a b c."}`); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid name to be rejected, got %d", recorder.Code)
+	}
+	for _, model := range []string{"forum", ""} {
+		if recorder := call(http.MethodPost, "/api/markov/train", `{"model": "`+model+`", "corpus": "The forum is busy today. The forum is quiet."}`); recorder.Code != http.StatusOK {
+			t.Fatalf("training %q: %d %s", model, recorder.Code, recorder.Body)
+		}
+	}
+
+	var list utilities.ApiMarkovListReply
+	if err := json.NewDecoder(call(http.MethodGet, "/api/markov/list", "").Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Models) != 2 || list.Models[0].Name != "forum" || list.Models[1].Name != utilities.DefaultModel || list.Models[0].Size == 0 {
+		t.Fatalf("expected both models, got %+v", list)
+	}
+
+	var info utilities.ModelStats
+	recorder := call(http.MethodGet, "/api/markov/info?model=forum&samples=2&trials=50", "")
+	if err := json.NewDecoder(recorder.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "forum" || info.Order == 0 || info.Vocabulary != 6 || len(info.Samples) != 2 || info.VerbatimRate == nil || info.Trials != 50 {
+		t.Fatalf("expected the forum model's stats, got %+v", info)
+	}
+	if recorder := call(http.MethodGet, "/api/markov/info?model=forum&samples=1000", ""); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected too many samples to be rejected, got %d", recorder.Code)
+	}
+	if recorder := call(http.MethodGet, "/api/markov/info?model=missing", ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing model to 404, got %d", recorder.Code)
+	}
+
+	recorder = call(http.MethodGet, "/api/markov/export?model=forum.json", "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "forum") {
+		t.Fatalf("expected the exported model, got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := call(http.MethodGet, "/api/markov/export?model=missing", ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing model to 404, got %d", recorder.Code)
+	}
+
+	if recorder := call(http.MethodPost, "/api/markov/delete", `{"model": "forum"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := call(http.MethodPost, "/api/markov/delete", `{"model": "forum"}`); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected deleting twice to 404, got %d", recorder.Code)
+	}
+	if names := utilities.MarkovModels.Names(); len(names) != 1 || names[0] != utilities.DefaultModel {
+		t.Fatalf("expected only the default model left, got %v", names)
+	}
+}
+
+func TestMarkovUpload(t *testing.T) {
+	models := utilities.MarkovModels
+	utilities.MarkovModels = utilities.NewModelRegistry(t.TempDir())
+	defer func() { utilities.MarkovModels = models }()
+	tp := New(NewConfigManager(DefaultConfig()), NewMemoryStore(), TemplateDir(t.TempDir()))
+	upload := func(path, contentType string, body io.Reader) (int, []utilities.ApiMarkovUploadProgress) {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, body)
+		request.Header.Set("Content-Type", contentType)
+		tp.APIHandler(recorder, request)
+		var lines []utilities.ApiMarkovUploadProgress
+		decoder := json.NewDecoder(recorder.Body)
+		for recorder.Code == http.StatusOK && decoder.More() {
+			var line utilities.ApiMarkovUploadProgress
+			if err := decoder.Decode(&line); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, line)
+		}
+		return recorder.Code, lines
+	}
+
+	var form bytes.Buffer
+	parts := multipart.NewWriter(&form)
+	parts.WriteField("note", "not a file")
+	file, _ := parts.CreateFormFile("file", "forum.txt")
+	file.Write([]byte(strings.Repeat("Posting in the forum again. Replies are slow today. ", 20000)))
+	file, _ = parts.CreateFormFile("file", "page.html")
+	file.Write([]byte("<p>Read the rules first.</p>"))
+	parts.Close()
+	status, lines := upload("/api/markov/upload?model=forum", parts.FormDataContentType(), &form)
+	if status != http.StatusOK || len(lines) < 2 {
+		t.Fatalf("expected progress and a final line, got %d %+v", status, lines)
+	}
+	final := lines[len(lines)-1]
+	if !final.Done || final.Error != "" || final.Files != 2 || final.Tokens != 180004 || lines[0].Tokens < 100000 {
+		t.Fatalf("expected the upload to finish with 180004 tokens, got %+v", lines)
+	}
+	if utilities.MarkovModels.Get("forum") == nil {
+		t.Fatal("the trained model was not swapped in")
+	}
+
+	status, lines = upload("/api/markov/upload?fileName=posts.jsonl", "application/x-ndjson", strings.NewReader("{\"text\": \"One post.\"}\nbroken\n"))
+	if status != http.StatusOK || len(lines) != 1 || lines[0].Done || !strings.Contains(lines[0].Error, "posts.jsonl:2") {
+		t.Fatalf("expected the broken line to be reported, got %+v", lines)
+	}
+	if utilities.MarkovModels.Get(utilities.DefaultModel) != nil {
+		t.Fatal("a failed upload created a model")
+	}
+
+	if status, _ := upload("/api/markov/upload?model=../x", "text/plain", strings.NewReader("Text.")); status != http.StatusBadRequest {
+		t.Fatalf("expected an invalid name to be rejected, got %d", status)
+	}
+}
+
+func TestRequestLogAPI(t *testing.T) {
+	tp := newTestTarpit(t)
+	tp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/some/page", nil))
+	call := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		tp.APIHandler(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	recorder := call("/api/logging/requests?path=/some/")
+	var reply utilities.ApiRequestLogReply
+	if err := json.NewDecoder(recorder.Body).Decode(&reply); err != nil || recorder.Code != http.StatusOK || len(reply.Requests) != 1 {
+		t.Fatalf("expected the logged request, got %d %+v, %v", recorder.Code, reply, err)
+	}
+	for _, query := range []string{"since=yesterday", "limit=-1", "offset=x"} {
+		if recorder := call("/api/logging/requests?" + query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, recorder.Code)
+		}
+	}
+}
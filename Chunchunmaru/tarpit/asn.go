@@ -0,0 +1,124 @@
+package tarpit
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// asnRange One row of an IP-to-ASN database
+type asnRange struct {
+	start netip.Addr
+	end   netip.Addr
+	asn   uint32
+	name  string
+}
+
+// ASNDatabase An offline IP-to-ASN lookup table.
+type ASNDatabase struct {
+	ranges []asnRange
+}
+
+// LoadASNDatabase Loads an IP-to-ASN database in the tab separated format published by iptoasn.com, one range per line:
+// range_start, range_end, AS_number, country_code, AS_description. Ranges with AS number 0 are unrouted and skipped.
+func LoadASNDatabase(path string) (*ASNDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := &ASNDatabase{}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected at least 3 tab separated fields", path, line)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[2]), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if asn == 0 {
+			continue
+		}
+		entry := asnRange{start: start.Unmap(), end: end.Unmap(), asn: uint32(asn)}
+		if len(fields) >= 5 {
+			entry.name = fields[4]
+		}
+		db.ranges = append(db.ranges, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+	return db, nil
+}
+
+// Lookup Returns the AS number and name announcing addr, if any.
+func (db *ASNDatabase) Lookup(addr netip.Addr) (uint32, string, bool) {
+	if db == nil || !addr.IsValid() {
+		return 0, "", false
+	}
+	addr = addr.Unmap()
+	// Find the last range starting at or before addr
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	}) - 1
+	if i < 0 || db.ranges[i].end.Less(addr) || db.ranges[i].start.BitLen() != addr.BitLen() {
+		return 0, "", false
+	}
+	return db.ranges[i].asn, db.ranges[i].name, true
+}
+
+// asnCache Loads the configured ASN database once and keeps it until the configured path changes.
+type asnCache struct {
+	mu   sync.Mutex
+	path string
+	db   *ASNDatabase
+}
+
+// get Returns the database at path, loading it on first use. A database that fails to load is logged and then treated
+// as empty until the path changes.
+func (c *asnCache) get(path string) *ASNDatabase {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if path == c.path {
+		return c.db
+	}
+	c.path, c.db = path, nil
+	if path == "" {
+		return nil
+	}
+	db, err := LoadASNDatabase(path)
+	if err != nil {
+		log.Printf("Error loading ASN database %s: %s\n", path, err)
+		return nil
+	}
+	log.Printf("Loaded %d ASN ranges from %s\n", len(db.ranges), path)
+	c.db = db
+	return db
+}
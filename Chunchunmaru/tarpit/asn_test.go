@@ -0,0 +1,41 @@
+package tarpit
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestASNDatabaseLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip2asn-combined.tsv")
+	data := "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+		"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+		"2001:db8::\t2001:db8:ffff:ffff:ffff:ffff:ffff:ffff\t64500\tZZ\tDOCUMENTATION\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := LoadASNDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		addr string
+		asn  uint32
+		ok   bool
+	}{
+		{"1.0.0.1", 13335, true},
+		{"::ffff:1.0.0.200", 13335, true},
+		{"1.0.2.1", 0, false},
+		{"9.9.9.9", 0, false},
+		{"2001:db8:1::1", 64500, true},
+		{"2001:db9::1", 0, false},
+	}
+	for _, c := range cases {
+		asn, _, ok := db.Lookup(netip.MustParseAddr(c.addr))
+		if asn != c.asn || ok != c.ok {
+			t.Errorf("%s: expected %d/%v, got %d/%v", c.addr, c.asn, c.ok, asn, ok)
+		}
+	}
+}
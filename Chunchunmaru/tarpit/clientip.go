@@ -0,0 +1,143 @@
+package tarpit
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientAddr Returns the address of the client behind r. Forwarding headers are only believed when the connection comes
+// from one of the configured TrustedProxies, in which case the chain is walked back to the first untrusted hop.
+func ClientAddr(r *http.Request, config Config) netip.Addr {
+	peer := parseHost(r.RemoteAddr)
+	trusted := parseTrustedProxies(config.TrustedProxies)
+	if !peer.IsValid() || !isTrusted(trusted, peer) {
+		return peer
+	}
+
+	// Hops are listed client first, so walk them from the end
+	hops := forwardedHops(r.Header)
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHost(hops[i])
+		if !hop.IsValid() {
+			break
+		}
+		client = hop
+		if !isTrusted(trusted, hop) {
+			break
+		}
+	}
+	return client
+}
+
+// ClientKey Returns the key a client address is recorded under. IPv6 clients are grouped by the configured IPv6Prefix
+// since a single host usually controls a whole /64.
+func ClientKey(addr netip.Addr, config Config) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	if addr.Is6() && config.IPv6Prefix > 0 && config.IPv6Prefix < 128 {
+		if prefix, err := addr.Prefix(config.IPv6Prefix); err == nil {
+			return prefix.String()
+		}
+	}
+	return addr.String()
+}
+
+// forwardedHops Returns the addresses listed by the Forwarded, X-Forwarded-For or X-Real-IP headers, preferring the
+// standardised header.
+func forwardedHops(header http.Header) []string {
+	var hops []string
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return hops
+	}
+	if values := header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, hop := range strings.Split(strings.Join(values, ","), ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+		return hops
+	}
+	if realIP := header.Get("X-Real-IP"); realIP != "" {
+		hops = append(hops, strings.TrimSpace(realIP))
+	}
+	return hops
+}
+
+// parseHost Parses an address that may carry a port, IPv6 brackets or a zone.
+func parseHost(hostport string) netip.Addr {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.WithZone("").Unmap()
+}
+
+// parseTrustedProxies Parses a list of CIDRs or bare addresses, skipping invalid entries.
+func parseTrustedProxies(entries []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				log.Printf("Ignoring invalid trusted proxy %q: %s\n", entry, err)
+				continue
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q: %s\n", entry, err)
+			continue
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes
+}
+
+// isTrusted Reports whether addr falls inside one of the trusted prefixes
+func isTrusted(trusted []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SubnetKey Returns the subnet a client address is aggregated into, using SubnetPrefixV4 or SubnetPrefixV6. An empty
+// key means subnet aggregation is disabled for the address family.
+func SubnetKey(addr netip.Addr, config Config) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	bits := config.SubnetPrefixV4
+	if addr.Is6() {
+		bits = config.SubnetPrefixV6
+	}
+	if bits <= 0 || bits >= addr.BitLen() {
+		return ""
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
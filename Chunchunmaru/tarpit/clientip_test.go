@@ -0,0 +1,38 @@
+package tarpit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientKey(t *testing.T) {
+	config := DefaultConfig()
+	config.TrustedProxies = []string{"10.0.0.0/8", "::1"}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"ipv4", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"ipv6 grouped by /64", "[2001:db8:1:2:3:4:5:6]:443", nil, "2001:db8:1:2::/64"},
+		{"mapped ipv4", "[::ffff:203.0.113.7]:80", nil, "203.0.113.7"},
+		{"untrusted peer ignores headers", "203.0.113.7:80", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"trusted x-forwarded-for", "10.0.0.2:80", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"spoofed hop before untrusted", "10.0.0.2:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"forwarded header", "[::1]:80", map[string]string{"Forwarded": `for="[2001:db8::17]:4711";proto=https`}, "2001:db8::/64"},
+		{"x-real-ip", "10.1.1.1:80", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = c.remoteAddr
+		for key, value := range c.headers {
+			request.Header.Set(key, value)
+		}
+		if got := ClientKey(ClientAddr(request, config), config); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tarpit
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunRetention Prunes the request log and the client store every RetentionInterval, dropping log entries older than
+// RequestLogRetention, the oldest entries beyond RequestLogMaxRows and clients not seen for ClientRetention, until ctx
+// is cancelled. The config is reread on every pass.
+func (t *Tarpit) RunRetention(ctx context.Context) {
+	for {
+		interval := time.Duration(t.config.GetConfig().RetentionInterval)
+		if interval <= 0 {
+			interval = 10 * time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		now := time.Now()
+		t.pruneRequestLog(now)
+		t.pruneClients(now)
+	}
+}
+
+// pruneRequestLog Runs one retention pass as of now
+func (t *Tarpit) pruneRequestLog(now time.Time) {
+	config := t.config.GetConfig()
+	var cutoff time.Time
+	if config.RequestLogRetention > 0 {
+		cutoff = now.Add(-time.Duration(config.RequestLogRetention))
+	}
+	removed, err := t.store.PruneRequests(cutoff, config.RequestLogMaxRows)
+	if err != nil {
+		log.Println("Error pruning request log ", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Pruned %d entries from the request log\n", removed)
+	}
+}
+
+// pruneClients Forgets the clients not seen for ClientRetention as of now, unless it is zero
+func (t *Tarpit) pruneClients(now time.Time) {
+	retention := time.Duration(t.config.GetConfig().ClientRetention)
+	if retention <= 0 {
+		return
+	}
+	removed, err := t.store.Prune(now.Add(-retention))
+	if err != nil {
+		log.Println("Error pruning clients ", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Forgot %d clients not seen for %s\n", removed, retention)
+	}
+}
@@ -0,0 +1,176 @@
+package tarpit
+
+import (
+	"chunchunmaru/internal/utilities"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// History What the tarpit knows about the client behind a request, including the request itself. Subnet and ASN are
+// empty when aggregation is disabled or the client's AS is unknown.
+type History struct {
+	IP        utilities.ClientRecord
+	UserAgent utilities.ClientRecord
+	Subnet    utilities.ClientRecord
+	ASN       utilities.ClientRecord
+}
+
+// Scorer Contributes to a client's aggression. Each scorer returns a score between 0 and 100, which is multiplied by
+// the weight configured for its name in Config.ScoreWeights and added to the client's total.
+type Scorer interface {
+	// Name Returns the key the scorer's weight is configured under
+	Name() string
+	// Score Rates how scraper-like the request and the client's history look
+	Score(r *http.Request, history History, config Config) float64
+}
+
+// DefaultScorers Returns the built-in scorers
+func DefaultScorers() []Scorer {
+	return []Scorer{
+		RateScorer{},
+		UserAgentScorer{},
+		HeaderScorer{},
+		CookieScorer{},
+		TimingScorer{},
+		HoneypotScorer{},
+	}
+}
+
+// combineScores Runs every scorer over the request and returns the weighted total, clamped to 0-100.
+func combineScores(scorers []Scorer, r *http.Request, history History, config Config) int {
+	total := 0.0
+	for _, scorer := range scorers {
+		weight := config.ScoreWeights[scorer.Name()]
+		if weight == 0 {
+			continue
+		}
+		total += weight * scorer.Score(r, history, config)
+	}
+	return utilities.ClampInt(int(math.Round(total)), 0, 100)
+}
+
+// RateScorer Scores the decayed request rate of the client network or user agent, whichever is higher.
+type RateScorer struct{}
+
+func (RateScorer) Name() string { return "rate" }
+
+func (RateScorer) Score(_ *http.Request, history History, config Config) float64 {
+	return math.Max(networkRateScore(history, config), float64(aggressionFor(config, history.UserAgent.Rate)))
+}
+
+// networkRateScore Combines the rate scores of the client IP, subnet and ASN according to the AggregationMode, so that
+// scraper farms rotating addresses inside one network still build up aggression.
+func networkRateScore(history History, config Config) float64 {
+	levels := []struct {
+		name   string
+		record utilities.ClientRecord
+	}{
+		{"ip", history.IP},
+		{"subnet", history.Subnet},
+		{"asn", history.ASN},
+	}
+
+	score, totalWeight := 0.0, 0.0
+	for _, level := range levels {
+		weight, ok := config.AggregationWeights[level.name]
+		if !ok && level.name == "ip" {
+			weight = 1
+		}
+		if weight <= 0 || level.record.Queries == 0 {
+			continue
+		}
+		levelScore := float64(aggressionFor(config, level.record.Rate))
+		if config.AggregationMode == "weighted" {
+			score += weight * levelScore
+			totalWeight += weight
+		} else {
+			score = math.Max(score, weight*levelScore)
+		}
+	}
+	if config.AggregationMode == "weighted" && totalWeight > 0 {
+		score /= totalWeight
+	}
+	return score
+}
+
+// knownBotAgents Fragments of user agents sent by crawlers, scraping libraries and headless browsers
+var knownBotAgents = []string{
+	"bot", "crawl", "spider", "slurp", "scrapy", "python-requests", "python-urllib", "aiohttp", "httpx", "curl",
+	"wget", "go-http-client", "java/", "okhttp", "libwww", "axios", "node-fetch", "headless", "phantomjs",
+	"puppeteer", "playwright", "ccbot", "gptbot", "bytespider",
+}
+
+// UserAgentScorer Scores requests with no User-Agent, or one belonging to a known bot or HTTP library.
+type UserAgentScorer struct{}
+
+func (UserAgentScorer) Name() string { return "user_agent" }
+
+func (UserAgentScorer) Score(r *http.Request, _ History, _ Config) float64 {
+	userAgent := strings.ToLower(r.Header.Get("User-Agent"))
+	if userAgent == "" {
+		return 100
+	}
+	for _, fragment := range knownBotAgents {
+		if strings.Contains(userAgent, fragment) {
+			return 100
+		}
+	}
+	return 0
+}
+
+// HeaderScorer Scores requests missing the Accept-Language and Accept-Encoding headers every browser sends.
+type HeaderScorer struct{}
+
+func (HeaderScorer) Name() string { return "headers" }
+
+func (HeaderScorer) Score(r *http.Request, _ History, _ Config) float64 {
+	score := 0.0
+	if r.Header.Get("Accept-Language") == "" {
+		score += 50
+	}
+	if r.Header.Get("Accept-Encoding") == "" {
+		score += 50
+	}
+	return score
+}
+
+// CookieScorer Scores clients that keep coming back without the cookie the tarpit handed them.
+type CookieScorer struct{}
+
+func (CookieScorer) Name() string { return "cookies" }
+
+func (CookieScorer) Score(_ *http.Request, history History, config Config) float64 {
+	// The first request never has the cookie, so only judge clients that have had a few chances to send it back
+	if config.CookieName == "" || history.IP.Queries < 3 {
+		return 0
+	}
+	return 100 * float64(history.IP.CookieMisses) / float64(history.IP.Queries-1)
+}
+
+// TimingScorer Scores clients whose requests arrive at suspiciously regular intervals, as scheduled crawlers do.
+type TimingScorer struct{}
+
+func (TimingScorer) Name() string { return "timing" }
+
+func (TimingScorer) Score(_ *http.Request, history History, _ Config) float64 {
+	if history.IP.Queries < 5 || history.IP.IntervalMean <= 0 {
+		return 0
+	}
+	// Humans browse in bursts, so their intervals vary at least as much as their mean. A coefficient of variation
+	// below 0.5 starts to look scheduled, and below 0.1 looks like a timer.
+	variation := math.Sqrt(history.IP.IntervalVar) / history.IP.IntervalMean
+	return math.Min(math.Max((0.5-variation)/0.4, 0), 1) * 100
+}
+
+// HoneypotScorer Scores clients that have followed a link to one of the trap paths, which real users never see.
+type HoneypotScorer struct{}
+
+func (HoneypotScorer) Name() string { return "honeypot" }
+
+func (HoneypotScorer) Score(_ *http.Request, history History, _ Config) float64 {
+	if history.IP.HoneypotHits > 0 {
+		return 100
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package tarpit
+
+import (
+	"chunchunmaru/internal/utilities"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimingScorer(t *testing.T) {
+	start := time.Now()
+	scheduled, bursty := utilities.ClientRecord{}, utilities.ClientRecord{}
+	for i := 0; i < 20; i++ {
+		scheduled.Record(utilities.Hit{Time: start.Add(time.Duration(i) * 10 * time.Second)}, time.Hour)
+		// Alternate quick clicks with long reads
+		gap := time.Duration(i/2*60+i%2) * time.Second
+		bursty.Record(utilities.Hit{Time: start.Add(gap)}, time.Hour)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if score := (TimingScorer{}).Score(request, History{IP: scheduled}, DefaultConfig()); score != 100 {
+		t.Errorf("expected scheduled client to score 100, got %f", score)
+	}
+	if score := (TimingScorer{}).Score(request, History{IP: bursty}, DefaultConfig()); score != 0 {
+		t.Errorf("expected bursty client to score 0, got %f", score)
+	}
+}
+
+func TestCombineScoresClamps(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreWeights = map[string]float64{"user_agent": 3, "headers": 1}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if score := combineScores(DefaultScorers(), request, History{}, config); score != 100 {
+		t.Fatalf("expected score clamped to 100, got %d", score)
+	}
+}
+
+func TestMissingHeadersStayBelowSuspectAggression(t *testing.T) {
+	config := DefaultConfig()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	if score := combineScores(DefaultScorers(), request, History{}, config); score >= config.SuspectAggression {
+		t.Fatalf("expected a browser missing only Accept-Language and Accept-Encoding to score below %d, got %d", config.SuspectAggression, score)
+	}
+
+	request.Header.Del("User-Agent")
+	if score := combineScores(DefaultScorers(), request, History{}, config); score < config.SuspectAggression {
+		t.Fatalf("expected a request missing its User-Agent as well to reach %d, got %d", config.SuspectAggression, score)
+	}
+}
+
+func TestNetworkRateScore(t *testing.T) {
+	config := DefaultConfig()
+	config.QueriesPerAggression = 1
+	config.AggregationWeights = map[string]float64{"ip": 1, "subnet": 0.5, "asn": 0.25}
+	// A farm rotating addresses: every IP is fresh, but the subnet and AS are busy
+	history := History{
+		IP:     utilities.ClientRecord{Queries: 1, Rate: 1},
+		Subnet: utilities.ClientRecord{Queries: 100, Rate: 80},
+		ASN:    utilities.ClientRecord{Queries: 100, Rate: 100},
+	}
+
+	config.AggregationMode = "max"
+	if got := networkRateScore(history, config); got != 40 {
+		t.Errorf("max: expected 40, got %v", got)
+	}
+	config.AggregationMode = "weighted"
+	if got := networkRateScore(history, config); math.Abs(got-(1+40+25)/1.75) > 1e-9 {
+		t.Errorf("weighted: expected %v, got %v", (1+40+25)/1.75, got)
+	}
+}
@@ -0,0 +1,119 @@
+package tarpit
+
+import (
+	"chunchunmaru/internal/utilities"
+	"time"
+)
+
+// ClientStore Persists what is known about clients. See utilities.ClientStore.
+type ClientStore = utilities.ClientStore
+
+// SQLiteStore A ClientStore backed by a SQLite database
+type SQLiteStore = utilities.SQLiteStore
+
+// MemoryStore A ClientStore that keeps clients in memory only
+type MemoryStore = utilities.MemoryStore
+
+// BatchingStore A ClientStore that keeps the database off the request path. See utilities.BatchingStore.
+type BatchingStore = utilities.BatchingStore
+
+// StoreStats Queue counters reported by a BatchingStore
+type StoreStats = utilities.StoreStats
+
+// OpenSQLiteStore Opens or creates a SQLite database at path to record clients in
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	return utilities.OpenSQLiteStore(path)
+}
+
+// NewMemoryStore Returns a store that keeps clients in memory only, for tests and ephemeral deployments
+func NewMemoryStore() *MemoryStore {
+	return utilities.NewMemoryStore()
+}
+
+// NewBatchingStore Returns a store that applies hits in memory and flushes them to backend every interval, queueing at
+// most queueSize changes and caching up to cacheSize idle clients. Close it to write out the final batch.
+func NewBatchingStore(backend utilities.BatchStore, interval time.Duration, queueSize, cacheSize int) *BatchingStore {
+	return utilities.NewBatchingStore(backend, interval, queueSize, cacheSize)
+}
+
+// aggressionFor Converts a decayed request rate into an aggression score between 0 and 100.
+func aggressionFor(config Config, rate float64) int {
+	if config.QueriesPerAggression <= 0 {
+		return 0
+	}
+	return utilities.ClampInt(int(rate)/config.QueriesPerAggression, 0, 100)
+}
+
+// recordClientHit Counts hit against one client and returns its updated record.
+func recordClientHit(store ClientStore, config Config, kind utilities.ClientKind, key string, hit utilities.Hit) (utilities.ClientRecord, error) {
+	return store.RecordHit(kind, key, func(record *utilities.ClientRecord) {
+		record.Record(hit, time.Duration(config.AggressionHalfLife))
+		record.Aggression = aggressionFor(config, record.Rate)
+	})
+}
+
+// clientKeys The keys a request is recorded under. Empty subnet and ASN keys are not recorded.
+type clientKeys struct {
+	IP        string
+	UserAgent string
+	Subnet    string
+	ASN       string
+}
+
+// recordHit Counts hit against every key of the client and returns what is now known about each.
+func recordHit(store ClientStore, config Config, keys clientKeys, hit utilities.Hit) (History, error) {
+	var history History
+	var err error
+	if history.IP, err = recordClientHit(store, config, utilities.ClientIP, keys.IP, hit); err != nil {
+		return history, err
+	}
+	if history.UserAgent, err = recordClientHit(store, config, utilities.ClientUserAgent, keys.UserAgent, hit); err != nil {
+		return history, err
+	}
+	if keys.Subnet != "" {
+		if history.Subnet, err = recordClientHit(store, config, utilities.ClientSubnet, keys.Subnet, hit); err != nil {
+			return history, err
+		}
+	}
+	if keys.ASN != "" {
+		if history.ASN, err = recordClientHit(store, config, utilities.ClientASN, keys.ASN, hit); err != nil {
+			return history, err
+		}
+	}
+	return history, nil
+}
+
+// currentRecords Lists every client of kind with its rate and aggression decayed to now rather than as of its last hit.
+func currentRecords(store ClientStore, config Config, kind utilities.ClientKind) ([]utilities.ClientRecord, error) {
+	records, err := store.List(kind)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range records {
+		records[i].Rate = records[i].RateAt(now, time.Duration(config.AggressionHalfLife))
+		records[i].Aggression = aggressionFor(config, records[i].Rate)
+	}
+	return records, nil
+}
+
+// sumQueries Returns the total number of queries made by clients of kind
+func sumQueries(store ClientStore, kind utilities.ClientKind) (int, error) {
+	records, err := store.List(kind)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, record := range records {
+		total += record.Queries
+	}
+	return total, nil
+}
+
+// unixNano Returns t in Unix nanoseconds, or 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,261 @@
+// Package tarpit exposes Chunchunmaru as an embeddable http.Handler, plus a middleware that diverts suspected
+// scrapers away from a real site and into the tarpit.
+package tarpit
+
+import (
+	"chunchunmaru/internal/macros"
+	"chunchunmaru/internal/utilities"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Config Settings the tarpit runs with. See utilities.Config for the individual fields.
+type Config = utilities.Config
+
+// ConfigManager Holds a Config that can be swapped while the tarpit is serving.
+type ConfigManager = utilities.ConfigManager
+
+// Duration A time.Duration that marshals to and from JSON as either a string or a number of seconds.
+type Duration = utilities.Duration
+
+// NewConfigManager Returns a config manager holding config
+func NewConfigManager(config Config) *ConfigManager {
+	return utilities.NewConfigManager(config)
+}
+
+// DefaultConfig Returns the configuration Chunchunmaru starts with
+func DefaultConfig() Config {
+	return utilities.DefaultConfig()
+}
+
+// TemplateSource Supplies the page templates the tarpit renders.
+type TemplateSource interface {
+	// Pick Selects a template using r and returns its name and source.
+	Pick(r *rand.Rand) (string, string, error)
+}
+
+// TemplateDir A TemplateSource serving the .html files of a directory. This is also the source the admin API manages.
+type TemplateDir string
+
+// Pick Selects a random .html file from the directory
+func (dir TemplateDir) Pick(r *rand.Rand) (string, string, error) {
+	content, name, err := utilities.RandomHTMLFromDir(string(dir), r)
+	return name, content, err
+}
+
+// Tarpit Serves endless generated pages to scrapers, slowing down as the client gets more aggressive.
+type Tarpit struct {
+	config    *ConfigManager
+	store     ClientStore
+	templates TemplateSource
+	scorers   []Scorer
+	asn       asnCache
+	started   time.Time
+}
+
+// New Returns a tarpit using config, recording clients in store and rendering pages from templates.
+func New(config *ConfigManager, store ClientStore, templates TemplateSource) *Tarpit {
+	return &Tarpit{
+		config:    config,
+		store:     store,
+		templates: templates,
+		scorers:   DefaultScorers(),
+		started:   time.Now(),
+	}
+}
+
+// SetScorers Replaces the scorers that make up a client's aggression. Only call this before serving.
+func (t *Tarpit) SetScorers(scorers ...Scorer) {
+	t.scorers = scorers
+}
+
+// Config Returns the tarpit's config manager
+func (t *Tarpit) Config() *ConfigManager {
+	return t.config
+}
+
+// Uptime Returns how long ago the tarpit was created
+func (t *Tarpit) Uptime() time.Duration {
+	return time.Since(t.started)
+}
+
+// ServeHTTP Records the client and serves it a generated page.
+func (t *Tarpit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.serve(w, r, t.assess(w, r))
+}
+
+// Middleware Returns a handler that records every request, sends requests for trap paths and clients at or above the
+// configured SuspectAggression into the tarpit, and passes everyone else through to next.
+func (t *Tarpit) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := t.config.GetConfig()
+		assessment := t.assess(w, r)
+		if isTrapPath(config.TrapPaths, r.URL.Path) || (config.SuspectAggression > 0 && assessment.aggression >= config.SuspectAggression) {
+			t.serve(w, r, assessment)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isTrapPath Reports whether path falls under one of the trap path prefixes
+func isTrapPath(trapPaths []string, path string) bool {
+	for _, prefix := range trapPaths {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// assessment What assess found out about a request
+type assessment struct {
+	addr       netip.Addr
+	aggression int
+}
+
+// assess Records the request against its client, hands out the tracking cookie if the client lacks it, and returns
+// the client's address and combined aggression.
+func (t *Tarpit) assess(w http.ResponseWriter, r *http.Request) assessment {
+	config := t.config.GetConfig()
+	addr := ClientAddr(r, config)
+	keys := clientKeys{
+		IP:        ClientKey(addr, config),
+		UserAgent: r.Header.Get("User-Agent"),
+		Subnet:    SubnetKey(addr, config),
+	}
+	if keys.IP == "" {
+		keys.IP = r.RemoteAddr
+	}
+	if asn, _, ok := t.asn.get(config.ASNDatabase).Lookup(addr); ok {
+		keys.ASN = fmt.Sprintf("AS%d", asn)
+	}
+	hit := utilities.Hit{
+		Time:     time.Now(),
+		Honeypot: isTrapPath(config.TrapPaths, r.URL.Path),
+	}
+	if config.CookieName != "" {
+		if _, err := r.Cookie(config.CookieName); err == nil {
+			hit.HasCookie = true
+		} else {
+			http.SetCookie(w, &http.Cookie{Name: config.CookieName, Value: newCookieValue(), Path: "/", HttpOnly: true})
+		}
+	}
+
+	history, err := recordHit(t.store, config, keys, hit)
+	if err != nil {
+		log.Println(err)
+	}
+	return assessment{addr: addr, aggression: combineScores(t.scorers, r, history, config)}
+}
+
+// newCookieValue Returns a random value for the tracking cookie
+func newCookieValue() string {
+	value := make([]byte, 16)
+	_, _ = cryptorand.Read(value)
+	return hex.EncodeToString(value)
+}
+
+// pickTemplate Selects the template for a request at aggression and binds its macros to seed. Templates from a
+// TemplateRegistry are already parsed and picked by their front matter, others are parsed here.
+func (t *Tarpit) pickTemplate(seed int64, aggression int, config Config) (string, *template.Template, macros.FrontMatter, error) {
+	r := rand.New(rand.NewSource(seed))
+	if registry, ok := t.templates.(*TemplateRegistry); ok {
+		registered, err := registry.pick(r, aggression)
+		if err != nil {
+			return "", nil, macros.FrontMatter{}, err
+		}
+		tmpl, err := macros.Instantiate(registered.parsed, seed, config)
+		return registered.name, tmpl, registered.frontMatter, err
+	}
+	filename, html, err := t.templates.Pick(r)
+	if err != nil {
+		return filename, nil, macros.FrontMatter{}, err
+	}
+	frontMatter, _, err := macros.SplitFrontMatter(html)
+	if err != nil {
+		return filename, nil, frontMatter, err
+	}
+	tmpl, err := macros.BuildTemplate(filename, html, nil, seed, config)
+	return filename, tmpl, frontMatter, err
+}
+
+// templateBase Returns the partials and layouts the tarpit's templates are parsed on, if its source has any
+func (t *Tarpit) templateBase() *template.Template {
+	if registry, ok := t.templates.(*TemplateRegistry); ok {
+		return registry.Base()
+	}
+	return nil
+}
+
+// serve Renders a page for the request at the assessed aggression, drip-feeds it to the client and logs the request.
+func (t *Tarpit) serve(w http.ResponseWriter, r *http.Request, assessment assessment) {
+	config := t.config.GetConfig()
+	aggression := assessment.aggression
+	entry := utilities.RequestEntry{
+		Time:       time.Now(),
+		IP:         assessment.addr.String(),
+		UserAgent:  r.Header.Get("User-Agent"),
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Aggression: aggression,
+	}
+	if !assessment.addr.IsValid() {
+		entry.IP = r.RemoteAddr
+	}
+	defer func() {
+		if err := t.store.LogRequest(entry); err != nil {
+			log.Println("Error logging request ", err)
+		}
+	}()
+
+	seed := utilities.RequestSeed(config.Secret, r, config.SeedWithQuery)
+	filename, template, frontMatter, err := t.pickTemplate(seed, aggression, config)
+	entry.Template = filename
+	if err != nil {
+		log.Printf("Error picking template: %s", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Website delay
+	randomDelay := utilities.RandomDuration(time.Duration(config.MinDelay), time.Duration(config.MaxDelay))
+	log.Printf("Waiting with delay %fs\n", randomDelay.Seconds())
+	entry.Delay = randomDelay
+	select {
+	case <-r.Context().Done():
+		return
+	case <-time.After(randomDelay):
+	}
+
+	log.Printf("Serving template: %s with aggression %d\n", filename, aggression)
+	w.Header().Set("Content-Type", frontMatter.ContentType)
+	if frontMatter.CacheControl != "" {
+		w.Header().Set("Cache-Control", frontMatter.CacheControl)
+	}
+	if frontMatter.Expires > 0 {
+		w.Header().Set("Expires", time.Now().Add(frontMatter.Expires).UTC().Format(http.TimeFormat))
+	}
+	drip := utilities.NewDripWriter(r.Context(), w, config, aggression)
+	defer func() { entry.Bytes = int64(drip.Written()) }()
+	err = template.Execute(drip, macros.TemplateInput{Aggression: aggression, Seed: seed})
+	if err == nil {
+		err = drip.Flush()
+	}
+	if err != nil {
+		if errors.Is(err, utilities.ErrClientGone) || strings.Contains(err.Error(), "An established connection was aborted by the software in your host machine.") {
+			log.Printf("Error executing template: Client browser aborted the request after %d bytes.", drip.Written())
+		} else {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package tarpit
+
+import (
+	"chunchunmaru/internal/utilities"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticTemplates string
+
+func (s staticTemplates) Pick(_ *rand.Rand) (string, string, error) {
+	return "static.html", string(s), nil
+}
+
+func newTestTarpit(t *testing.T) *Tarpit {
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	config := DefaultConfig()
+	config.MinDelay, config.MaxDelay = 0, 0
+	config.MinChunkDelay, config.MaxChunkDelay = 0, 0
+	config.TrapPaths = []string{"/trap/"}
+	return New(NewConfigManager(config), store, staticTemplates("tarpit {{.Aggression}}"))
+}
+
+func TestMiddleware(t *testing.T) {
+	tp := newTestTarpit(t)
+	handler := tp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("real site"))
+	}))
+
+	// Ordered, since once a client has hit a trap it stays in the tarpit
+	cases := []struct{ path, want string }{
+		{"/", "real site"},
+		{"/about", "real site"},
+		{"/trap/", "tarpit"},
+		{"/trap/a/b/c/d", "tarpit"},
+		{"/about", "tarpit"},
+	}
+	for _, c := range cases {
+		path, want := c.path, c.want
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+		request.Header.Set("Accept-Language", "en-US,en;q=0.5")
+		request.Header.Set("Accept-Encoding", "gzip, deflate, br")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if !strings.HasPrefix(recorder.Body.String(), want) {
+			t.Errorf("%s: expected %q, got %q", path, want, recorder.Body.String())
+		}
+	}
+
+	// A bare scripted client gets diverted on headers alone
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "198.51.100.20:1234"
+	request.Header.Set("User-Agent", "python-requests/2.32.3")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if !strings.HasPrefix(recorder.Body.String(), "tarpit") {
+		t.Errorf("expected scripted client to be diverted, got %q", recorder.Body.String())
+	}
+}
+
+func TestRecordClientHitDecays(t *testing.T) {
+	tp := newTestTarpit(t)
+	config := tp.Config().GetConfig()
+	start := time.Now()
+
+	var record utilities.ClientRecord
+	for i := 0; i < 2*config.QueriesPerAggression; i++ {
+		record, _ = recordClientHit(tp.store, config, utilities.ClientIP, "203.0.113.7", utilities.Hit{Time: start})
+	}
+	if record.Aggression != 2 {
+		t.Fatalf("expected aggression 2 after a burst, got %d", record.Aggression)
+	}
+
+	later := start.Add(10 * time.Duration(config.AggressionHalfLife))
+	if record, _ = recordClientHit(tp.store, config, utilities.ClientIP, "203.0.113.7", utilities.Hit{Time: later}); record.Aggression != 0 {
+		t.Fatalf("expected aggression to decay to 0, got %d", record.Aggression)
+	}
+}
+
+func TestServeLogsRequest(t *testing.T) {
+	tp := newTestTarpit(t)
+	request := httptest.NewRequest(http.MethodGet, "/some/page?x=1", nil)
+	request.Header.Set("User-Agent", "python-requests/2.31")
+	recorder := httptest.NewRecorder()
+	tp.ServeHTTP(recorder, request)
+
+	entries, err := tp.store.Requests(utilities.RequestFilter{PathPrefix: "/some/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 logged request, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.IP != "192.0.2.1" || entry.Query != "x=1" || entry.Template != "static.html" || entry.Bytes != int64(recorder.Body.Len()) {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+}
+
+func TestPruneClients(t *testing.T) {
+	tp := newTestTarpit(t)
+	config := tp.Config().GetConfig()
+	now := time.Now()
+	retention := time.Duration(config.ClientRetention)
+	recordClientHit(tp.store, config, utilities.ClientIP, "203.0.113.7", utilities.Hit{Time: now.Add(-retention - time.Hour)})
+	recordClientHit(tp.store, config, utilities.ClientIP, "203.0.113.8", utilities.Hit{Time: now.Add(-time.Hour)})
+
+	tp.pruneClients(now)
+	if _, seen, _ := tp.store.Reputation(utilities.ClientIP, "203.0.113.7"); seen {
+		t.Fatal("expected the client not seen for longer than client_retention to be forgotten")
+	}
+	if _, seen, _ := tp.store.Reputation(utilities.ClientIP, "203.0.113.8"); !seen {
+		t.Fatal("expected the recent client to be kept")
+	}
+
+	// Zero keeps clients forever
+	config.ClientRetention = 0
+	tp.Config().SetConfig(config)
+	tp.pruneClients(now.Add(100 * retention))
+	if _, seen, _ := tp.store.Reputation(utilities.ClientIP, "203.0.113.8"); !seen {
+		t.Fatal("expected no pruning with client_retention 0")
+	}
+}
@@ -0,0 +1,338 @@
+package tarpit
+
+import (
+	"chunchunmaru/internal/macros"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// registeredTemplate One parsed template of a TemplateRegistry
+type registeredTemplate struct {
+	name        string
+	source      string
+	frontMatter macros.FrontMatter
+	parsed      *template.Template
+	modTime     time.Time
+	size        int64
+}
+
+// templateSet Everything a TemplateRegistry serves at one point in time. Sets are never changed once published.
+type templateSet struct {
+	// templates Ordered by name, so a seed picks the same template whenever the set is the same
+	templates []*registeredTemplate
+	// failures Templates on disk that failed to parse. Those that parsed before are still served in their last good
+	// version.
+	failures map[string]templateFailure
+	// base The partials and layouts the templates were parsed on, nil if there are none, and baseStamp identifies the
+	// version of them last parsed
+	base      *template.Template
+	baseStamp string
+}
+
+// templateFailure Why a template file failed to parse, and which version of the file it was
+type templateFailure struct {
+	err     error
+	modTime time.Time
+	size    int64
+}
+
+// TemplateInfo What a TemplateRegistry knows about one template
+type TemplateInfo struct {
+	Name        string
+	Size        int64
+	ModTime     time.Time
+	FrontMatter macros.FrontMatter
+	// Err Why the file on disk failed to parse, if it did
+	Err error
+}
+
+// TemplateRegistry A TemplateSource that parses the .html files of a directory once and reparses them when they
+// change, keeping the last version that parsed when an edit breaks a template. The partials and layouts in the
+// directory's partials and layouts subdirectories are parsed into the base set every page is built on; when they
+// change, every page is reparsed. Each registry has its own base set.
+type TemplateRegistry struct {
+	dir string
+	set atomic.Pointer[templateSet]
+	// reloadMu Keeps reloads from racing each other
+	reloadMu sync.Mutex
+}
+
+// NewTemplateRegistry Returns a registry of the templates in dir, parsing them all. Fails if the directory can't be
+// read, but not when single templates fail to parse; see Templates for those.
+func NewTemplateRegistry(dir string) (*TemplateRegistry, error) {
+	registry := &TemplateRegistry{dir: dir}
+	registry.set.Store(&templateSet{failures: map[string]templateFailure{}})
+	if err := registry.Reload(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Dir Returns the directory the registry serves
+func (tr *TemplateRegistry) Dir() string {
+	return tr.dir
+}
+
+// Base Returns the set of partials and layouts pages are parsed on, or nil if there are none
+func (tr *TemplateRegistry) Base() *template.Template {
+	return tr.set.Load().base
+}
+
+// Reload Rereads the directory, parsing templates that were added or changed since the last reload and dropping those
+// that were removed. The new set replaces the old one all at once.
+func (tr *TemplateRegistry) Reload() error {
+	tr.reloadMu.Lock()
+	defer tr.reloadMu.Unlock()
+	files, err := os.ReadDir(tr.dir)
+	if err != nil {
+		return err
+	}
+
+	current := tr.set.Load()
+	previous := make(map[string]*registeredTemplate, len(current.templates))
+	for _, registered := range current.templates {
+		previous[registered.name] = registered
+	}
+	next := &templateSet{failures: map[string]templateFailure{}, base: current.base}
+	baseChanged, err := tr.reloadBase(current, next)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(strings.ToLower(file.Name()), ".html") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		old := previous[file.Name()]
+		// Files that haven't changed since they were last parsed, or failed to parse, are left alone
+		if failure, ok := current.failures[file.Name()]; ok && failure.modTime.Equal(info.ModTime()) && failure.size == info.Size() && !baseChanged {
+			next.failures[file.Name()] = failure
+			if old != nil {
+				next.templates = append(next.templates, old)
+			}
+			continue
+		}
+		if old != nil && old.modTime.Equal(info.ModTime()) && old.size == info.Size() && !baseChanged {
+			next.templates = append(next.templates, old)
+			continue
+		}
+
+		registered, err := parseTemplateFile(filepath.Join(tr.dir, file.Name()), info, next.base)
+		if err != nil {
+			next.failures[file.Name()] = templateFailure{err: err, modTime: info.ModTime(), size: info.Size()}
+			if old != nil {
+				log.Printf("Error reparsing template %s, still serving the previous version: %s\n", file.Name(), err)
+				next.templates = append(next.templates, old)
+			} else {
+				log.Printf("Error parsing template %s: %s\n", file.Name(), err)
+			}
+			continue
+		}
+		if old != nil && !baseChanged {
+			log.Printf("Reloaded template %s\n", file.Name())
+		}
+		next.templates = append(next.templates, registered)
+	}
+
+	sort.Slice(next.templates, func(i, j int) bool {
+		return next.templates[i].name < next.templates[j].name
+	})
+	tr.set.Store(next)
+	return nil
+}
+
+// reloadBase Reparses the partials and layouts into the base set if any of them changed, recording the outcome in next.
+// Reports whether the base set was replaced, in which case every page has to be reparsed on it. When a shared template
+// fails to parse, the previous base set stays in use.
+func (tr *TemplateRegistry) reloadBase(current, next *templateSet) (bool, error) {
+	sources := make(map[string]string)
+	var stamp strings.Builder
+	for _, sub := range []string{macros.PartialsDir, macros.LayoutsDir} {
+		files, err := os.ReadDir(filepath.Join(tr.dir, sub))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(strings.ToLower(file.Name()), ".html") {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(&stamp, "%s/%s %d %d\n", sub, file.Name(), info.ModTime().UnixNano(), info.Size())
+			content, err := os.ReadFile(filepath.Join(tr.dir, sub, file.Name()))
+			if err != nil {
+				return false, err
+			}
+			sources[sub+"/"+strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))] = string(content)
+		}
+	}
+
+	next.baseStamp = stamp.String()
+	if next.baseStamp == current.baseStamp {
+		for name, failure := range current.failures {
+			if strings.Contains(name, "/") {
+				next.failures[name] = failure
+			}
+		}
+		return false, nil
+	}
+	base, err := macros.ParseBase(sources)
+	if err != nil {
+		name := baseFailureName(err)
+		log.Printf("Error parsing %s, still using the previous partials and layouts: %s\n", name, err)
+		next.failures[name] = templateFailure{err: err}
+		return false, nil
+	}
+	if current.baseStamp != "" || len(sources) > 0 {
+		log.Printf("Loaded %d partials and layouts\n", len(sources))
+	}
+	next.base = base
+	return true, nil
+}
+
+// baseFailureName Returns the name a failure to parse the base set is reported under: the file at fault, or for a
+// failure that can't be pinned on one file, the partials directory. Either has a "/", so reloadBase keeps the failure
+// until the base set parses again.
+func baseFailureName(err error) string {
+	var templateErr macros.TemplateError
+	if errors.As(err, &templateErr) && templateErr.Name != "" {
+		return templateErr.Name + ".html"
+	}
+	return macros.PartialsDir + "/"
+}
+
+// parseTemplateFile Reads and parses one template on base
+func parseTemplateFile(path string, info os.FileInfo, base *template.Template) (*registeredTemplate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	frontMatter, _, err := macros.SplitFrontMatter(string(content))
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := macros.ParseTemplate(info.Name(), string(content), base)
+	if err != nil {
+		return nil, err
+	}
+	return &registeredTemplate{
+		name:        info.Name(),
+		source:      string(content),
+		frontMatter: frontMatter,
+		parsed:      parsed,
+		modTime:     info.ModTime(),
+		size:        info.Size(),
+	}, nil
+}
+
+// Watch Reloads the registry every interval until ctx is done
+func (tr *TemplateRegistry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := tr.Reload(); err != nil {
+				log.Println("Error reloading templates ", err)
+			}
+		}
+	}
+}
+
+// pick Selects a parsed template for a client at aggression using r, weighted by the templates' front matter. When
+// no template covers aggression, every template is a candidate.
+func (tr *TemplateRegistry) pick(r *rand.Rand, aggression int) (*registeredTemplate, error) {
+	templates := tr.set.Load().templates
+	if len(templates) == 0 {
+		return nil, errors.New("no HTML files found in directory")
+	}
+	if registered := pickWeighted(r, templates, aggression, true); registered != nil {
+		return registered, nil
+	}
+	if registered := pickWeighted(r, templates, aggression, false); registered != nil {
+		return registered, nil
+	}
+	return templates[r.Intn(len(templates))], nil
+}
+
+// pickWeighted Selects one of templates by weight, only among those matching aggression if inRange is set. Returns
+// nil if there is no candidate with a positive weight.
+func pickWeighted(r *rand.Rand, templates []*registeredTemplate, aggression int, inRange bool) *registeredTemplate {
+	total := 0.0
+	for _, registered := range templates {
+		if !inRange || registered.frontMatter.Matches(aggression) {
+			total += registered.frontMatter.Weight
+		}
+	}
+	if total <= 0 {
+		return nil
+	}
+	target := r.Float64() * total
+	var last *registeredTemplate
+	for _, registered := range templates {
+		if (inRange && !registered.frontMatter.Matches(aggression)) || registered.frontMatter.Weight <= 0 {
+			continue
+		}
+		last = registered
+		if target -= registered.frontMatter.Weight; target < 0 {
+			return registered
+		}
+	}
+	// Rounding can leave a sliver of target, which belongs to the last candidate
+	return last
+}
+
+// Pick Selects a template using r, as for a client at aggression 0, and returns its name and source
+func (tr *TemplateRegistry) Pick(r *rand.Rand) (string, string, error) {
+	registered, err := tr.pick(r, 0)
+	if err != nil {
+		return "", "", err
+	}
+	return registered.name, registered.source, nil
+}
+
+// Templates Lists the templates being served, and those that failed to parse, ordered by name
+func (tr *TemplateRegistry) Templates() []TemplateInfo {
+	set := tr.set.Load()
+	infos := make([]TemplateInfo, 0, len(set.templates)+len(set.failures))
+	served := make(map[string]bool, len(set.templates))
+	for _, registered := range set.templates {
+		served[registered.name] = true
+		infos = append(infos, TemplateInfo{
+			Name:        registered.name,
+			Size:        registered.size,
+			ModTime:     registered.modTime,
+			FrontMatter: registered.frontMatter,
+			Err:         set.failures[registered.name].err,
+		})
+	}
+	for name, failure := range set.failures {
+		if !served[name] {
+			infos = append(infos, TemplateInfo{Name: name, Size: failure.size, ModTime: failure.modTime, FrontMatter: macros.DefaultFrontMatter(), Err: failure.err})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
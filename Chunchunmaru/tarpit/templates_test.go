@@ -0,0 +1,233 @@
+package tarpit
+
+import (
+	"chunchunmaru/internal/macros"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTemplate Writes a template with a modification time of its own, so every write counts as a change
+func writeTemplate(t *testing.T, dir, name, content string, modified time.Time) {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateRegistryReload(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeTemplate(t, dir, "page.html", "version one", start)
+	writeTemplate(t, dir, "notes.txt", "not a template", start)
+
+	registry, err := NewTemplateRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.MinDelay, config.MaxDelay = 0, 0
+	config.MinChunkDelay, config.MaxChunkDelay = 0, 0
+	tp := New(NewConfigManager(config), NewMemoryStore(), registry)
+	page := func() string {
+		recorder := httptest.NewRecorder()
+		tp.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder.Body.String()
+	}
+	if body := page(); body != "version one" {
+		t.Fatalf("expected the parsed template, got %q", body)
+	}
+
+	writeTemplate(t, dir, "page.html", "version two", start.Add(time.Minute))
+	if body := page(); body != "version one" {
+		t.Fatalf("changes should only show after a reload, got %q", body)
+	}
+	if err := registry.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if body := page(); body != "version two" {
+		t.Fatalf("expected the reparsed template, got %q", body)
+	}
+
+	writeTemplate(t, dir, "page.html", "version {{ broken", start.Add(2*time.Minute))
+	writeTemplate(t, dir, "new.html", "{{ end }}", start)
+	if err := registry.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if body := page(); body != "version two" {
+		t.Fatalf("expected the last good version, got %q", body)
+	}
+	infos := registry.Templates()
+	if len(infos) != 2 || infos[0].Name != "new.html" || infos[0].Err == nil || infos[1].Name != "page.html" || infos[1].Err == nil {
+		t.Fatalf("expected both templates to report parse errors, got %+v", infos)
+	}
+
+	os.Remove(filepath.Join(dir, "new.html"))
+	writeTemplate(t, dir, "page.html", "version three", start.Add(3*time.Minute))
+	if err := registry.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	infos = registry.Templates()
+	if len(infos) != 1 || infos[0].Err != nil || !strings.Contains(page(), "three") {
+		t.Fatalf("expected only the fixed template, got %+v", infos)
+	}
+}
+
+func TestTemplateRegistryFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeTemplate(t, dir, "gentle.html", "---\nmax_aggression: 40\n---\ngentle", start)
+	writeTemplate(t, dir, "harsh.html", "---\nmin_aggression: 60\ncontent_type: text/plain\ncache_control: no-store\n---\nharsh", start)
+	writeTemplate(t, dir, "never.html", "---\nweight: 0\n---\nnever", start)
+	registry, err := NewTemplateRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		for aggression, want := range map[int]string{10: "gentle.html", 80: "harsh.html"} {
+			registered, err := registry.pick(rand.New(rand.NewSource(seed)), aggression)
+			if err != nil || registered.name != want {
+				t.Fatalf("aggression %d: expected %s, got %+v, %v", aggression, want, registered, err)
+			}
+		}
+		// Nothing covers 50, so any template with weight can be picked
+		if registered, _ := registry.pick(rand.New(rand.NewSource(seed)), 50); registered.name == "never.html" {
+			t.Fatal("a template with weight 0 was picked")
+		}
+	}
+
+	config := DefaultConfig()
+	config.MinDelay, config.MaxDelay = 0, 0
+	config.MinChunkDelay, config.MaxChunkDelay = 0, 0
+	config.TrapPaths = []string{"/"}
+	config.QueriesPerAggression = 1
+	tp := New(NewConfigManager(config), NewMemoryStore(), registry)
+	var recorder *httptest.ResponseRecorder
+	for i := 0; i < 200; i++ {
+		recorder = httptest.NewRecorder()
+		tp.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if recorder.Body.String() != "harsh" || recorder.Header().Get("Content-Type") != "text/plain" || recorder.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected the harsh template with its headers, got %q %v", recorder.Body, recorder.Header())
+	}
+}
+
+func TestTemplateRegistryPartials(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	if err := os.Mkdir(filepath.Join(dir, macros.PartialsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTemplate(t, dir, "partials/nav.html", "nav one", start)
+	writeTemplate(t, dir, "page.html", `{{template "partials/nav"}} {{partial "nav"}}`, start)
+	registry, err := NewTemplateRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.MinDelay, config.MaxDelay = 0, 0
+	config.MinChunkDelay, config.MaxChunkDelay = 0, 0
+	tp := New(NewConfigManager(config), NewMemoryStore(), registry)
+	page := func() string {
+		recorder := httptest.NewRecorder()
+		tp.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder.Body.String()
+	}
+	if body := page(); body != "nav one nav one" {
+		t.Fatalf("expected the partial in the page, got %q", body)
+	}
+
+	// Changing only the partial reparses the pages using it
+	writeTemplate(t, dir, "partials/nav.html", "nav two", start.Add(time.Minute))
+	if err := registry.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if body := page(); body != "nav two nav two" {
+		t.Fatalf("expected the changed partial, got %q", body)
+	}
+
+	writeTemplate(t, dir, "partials/nav.html", "nav {{ broken", start.Add(2*time.Minute))
+	if err := registry.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if body := page(); body != "nav two nav two" {
+		t.Fatalf("expected the last good partial, got %q", body)
+	}
+	var reported bool
+	for _, info := range registry.Templates() {
+		reported = reported || (info.Name == "partials/nav.html" && info.Err != nil)
+	}
+	if !reported {
+		t.Fatalf("expected the broken partial to be reported, got %+v", registry.Templates())
+	}
+
+	// Failures of the base set as a whole are kept until it parses again
+	broken := *registry.set.Load()
+	name := baseFailureName(errors.New("broken"))
+	broken.failures = map[string]templateFailure{name: {err: errors.New("broken")}}
+	registry.set.Store(&broken)
+	if err := registry.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if failures := registry.set.Load().failures; failures[name].err == nil {
+		t.Fatalf("expected the base set failure to be kept, got %+v", failures)
+	}
+
+	// Another registry in the same process has partials of its own
+	other := t.TempDir()
+	if err := os.Mkdir(filepath.Join(other, macros.PartialsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTemplate(t, other, "partials/nav.html", "other nav", start)
+	if _, err := NewTemplateRegistry(other); err != nil {
+		t.Fatal(err)
+	}
+	if body := page(); body != "nav two nav two" {
+		t.Fatalf("expected the registry's own partial, got %q", body)
+	}
+}
+
+func TestTemplateRegistryLayoutPages(t *testing.T) {
+	registry, err := NewTemplateRegistry("../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range registry.Templates() {
+		if info.Err != nil {
+			t.Fatalf("%s failed to parse: %v", info.Name, info.Err)
+		}
+	}
+	templates := registry.set.Load().templates
+	if len(templates) == 0 {
+		t.Fatal("expected the shipped templates")
+	}
+	for _, registered := range templates {
+		for _, aggression := range macros.TrialAggressions {
+			seed := int64(aggression)
+			tmpl, err := macros.Instantiate(registered.parsed, seed, DefaultConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var builder strings.Builder
+			if err := tmpl.Execute(&builder, macros.TemplateInput{Aggression: aggression, Seed: seed}); err != nil {
+				t.Fatalf("%s at aggression %d: %v", registered.name, aggression, err)
+			}
+			// The skeleton comes from layouts/page, and the header and footer from the partials
+			page := builder.String()
+			if strings.Count(page, "<!DOCTYPE html>") != 1 || !strings.HasSuffix(strings.TrimSpace(page), "</html>") ||
+				!strings.Contains(page, "<header>") || !strings.Contains(page, `<footer class="footer">`) {
+				t.Fatalf("%s at aggression %d was not rendered through the layout:\n%s", registered.name, aggression, page)
+			}
+		}
+	}
+}
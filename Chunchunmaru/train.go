@@ -0,0 +1,116 @@
+package main
+
+import (
+	"chunchunmaru/internal/utilities"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// runTrain Implements the train subcommand, which trains a Markov model on corpus files and archives, or standard input
+// if none or - is given, and saves it to the models directory the server loads.
+func runTrain(args []string) error {
+	flags := flag.NewFlagSet("train", flag.ExitOnError)
+	model := flags.String("model", utilities.DefaultModel, "name of the model to train, created if it doesn't exist")
+	dir := flags.String("models", utilities.ModelsDir, "directory the models are kept in")
+	maxSize := flags.Int64("max-file-size", int64(utilities.DefaultConfig().CorpusMaxFileSize), "most bytes of an HTML document or zip archive read")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s train [-model name] [-models dir] [-max-file-size bytes] [file ...]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Files may be text, Markdown, HTML, JSONL, or gzip, tar and zip archives of them.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	registry := utilities.NewModelRegistry(*dir)
+	if err := registry.Load(); err != nil {
+		return err
+	}
+	_, stats, err := registry.TrainFrom(*model, func(trainer *utilities.CorpusTrainer) error {
+		for _, file := range files {
+			if file == "-" {
+				if err := utilities.ReadCorpus("stdin", os.Stdin, *maxSize, trainer); err != nil {
+					return err
+				}
+				continue
+			}
+			input, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			err = utilities.ReadCorpus(file, input, *maxSize, trainer)
+			input.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(stats utilities.CorpusStats) {
+		fmt.Fprintf(os.Stderr, "%d tokens in %d sentences from %d files\n", stats.Tokens, stats.Sentences, stats.Files)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Trained %s on %d tokens in %d sentences from %d files\n", *model, stats.Tokens, stats.Sentences, stats.Files)
+	return nil
+}
+
+// runModelInfo Implements the model-info subcommand, which describes Markov models, samples their output and measures
+// how often it copies the training data verbatim.
+func runModelInfo(args []string) error {
+	flags := flag.NewFlagSet("model-info", flag.ExitOnError)
+	dir := flags.String("models", utilities.ModelsDir, "directory the models are kept in")
+	samples := flags.Int("samples", 5, "number of sample sentences to print")
+	trials := flags.Int("trials", 1000, "number of sentences generated to measure verbatim copies")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "seed for the generated sentences")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s model-info [-models dir] [-samples n] [-trials n] [-seed n] [model ...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	registry := utilities.NewModelRegistry(*dir)
+	if err := registry.Load(); err != nil {
+		return err
+	}
+	names := flags.Args()
+	if len(names) == 0 {
+		names = registry.Names()
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no models in %s", *dir)
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	for _, name := range names {
+		stats, err := registry.Stats(name, *samples, *trials, rng)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", stats.Name)
+		fmt.Printf("  order         %d\n", stats.Order)
+		fmt.Printf("  states        %d\n", stats.States)
+		fmt.Printf("  transitions   %d (%d observations)\n", stats.Transitions, stats.Observations)
+		fmt.Printf("  vocabulary    %d\n", stats.Vocabulary)
+		fmt.Printf("  file size     %d bytes\n", stats.FileSize)
+		if stats.VerbatimRate != nil {
+			fmt.Printf("  verbatim      %.1f%% of %d sentences copy one of %d training sentences\n", *stats.VerbatimRate*100, stats.Trials, stats.TrainingSentences)
+		} else if stats.TrainingSentences == 0 {
+			fmt.Printf("  verbatim      unknown, the model has no training fingerprints\n")
+		} else {
+			fmt.Printf("  verbatim      unknown, no generated sentence ended within the length limit\n")
+		}
+		for _, sample := range stats.Samples {
+			fmt.Printf("  > %s\n", sample)
+		}
+	}
+	return nil
+}
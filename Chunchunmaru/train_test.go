@@ -0,0 +1,37 @@
+package main
+
+import (
+	"chunchunmaru/internal/utilities"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunTrain(t *testing.T) {
+	dir := t.TempDir()
+	corpus := filepath.Join(dir, "corpus.md")
+	if err := os.WriteFile(corpus, []byte("# Notes\n\nThe product ships today. The docs ship tomorrow.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	models := filepath.Join(dir, "models")
+	if err := runTrain([]string{"-model", "docs", "-models", models, corpus}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runTrain([]string{"-model", "docs", "-models", models, filepath.Join(dir, "missing.txt")}); err == nil {
+		t.Fatal("expected a missing file to fail")
+	}
+
+	registry := utilities.NewModelRegistry(models)
+	if err := registry.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if registry.Get("docs") == nil {
+		t.Fatalf("expected the trained model to be saved, got %v", registry.Names())
+	}
+	if err := runModelInfo([]string{"-models", models, "-trials", "10", "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runModelInfo([]string{"-models", models, "missing"}); err == nil {
+		t.Fatal("expected a missing model to fail")
+	}
+}